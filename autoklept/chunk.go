@@ -0,0 +1,179 @@
+package autoklept
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// bytesPerToken is a deliberately pessimistic guess - markup tokenizes far worse than prose, and we'd rather send an
+// extra chunk than blow the context window.
+const bytesPerToken = 3
+
+// chunkSeparator sits between the stitched outputs of consecutive chunks.
+const chunkSeparator = "\n\n"
+
+var (
+	ErrBlockTooLarge          = errors.New("HTML block too large for a single chunk")
+	ErrMaxInputTokensTooSmall = errors.New("max input tokens leaves no room for HTML after the prompt")
+)
+
+// BlockTooLargeError is returned when a block can't be split any further, yet still doesn't fit in one chunk.
+// It matches ErrBlockTooLarge with errors.Is.
+type BlockTooLargeError struct {
+	Tag    string // The offending element, or "#text" for a bare run of text.
+	Tokens int    // Estimated tokens in the block.
+	Budget int    // Estimated tokens available for HTML in each chunk.
+}
+
+func (e *BlockTooLargeError) Error() string {
+	return fmt.Sprintf("%v: <%s> is ~%d tokens, budget is %d", ErrBlockTooLarge, e.Tag, e.Tokens, e.Budget)
+}
+
+func (e *BlockTooLargeError) Unwrap() error {
+	return ErrBlockTooLarge
+}
+
+// blockTags are the elements we're willing to split between. Anything else (links, emphasis, text...) stays glued to
+// its neighbours, so a sentence never gets cut in half.
+var blockTags = map[string]bool{
+	"html": true, "head": true, "body": true,
+	"address": true, "article": true, "aside": true, "blockquote": true, "details": true, "dialog": true,
+	"div": true, "dl": true, "dd": true, "dt": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hgroup": true, "hr": true, "li": true, "main": true, "nav": true, "ol": true, "p": true,
+	"pre": true, "section": true, "table": true, "tbody": true, "thead": true, "tfoot": true, "tr": true, "ul": true,
+}
+
+// EstimateTokens roughly guesses how many tokens `s` costs. It's no tokenizer, but it's close enough for budgeting.
+func EstimateTokens(s string) int {
+	return (len(s) + bytesPerToken - 1) / bytesPerToken
+}
+
+// chunkHTML splits `body` into pieces of at most `budget` estimated tokens, cutting only between block elements.
+// Wrapping elements that had to be split are dropped, since their children end up in different chunks anyway.
+func chunkHTML(body string, budget int) ([]string, error) {
+	if EstimateTokens(body) <= budget {
+		return []string{body}, nil
+	}
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing HTML for chunking: %w", err)
+	}
+	blocks, err := splitBlocks(doc, budget)
+	if err != nil {
+		return nil, err
+	}
+	// Greedily pack blocks back together, so we send as few requests as we can.
+	var chunks []string
+	var cur strings.Builder
+	for _, b := range blocks {
+		if cur.Len() > 0 && EstimateTokens(cur.String()+b) > budget {
+			chunks = append(chunks, cur.String())
+			cur.Reset()
+		}
+		cur.WriteString(b)
+	}
+	if cur.Len() > 0 {
+		chunks = append(chunks, cur.String())
+	}
+	return chunks, nil
+}
+
+// splitBlocks renders `n` as a single block if it fits, otherwise descends into its children.
+func splitBlocks(n *html.Node, budget int) ([]string, error) {
+	rendered, err := renderNode(n)
+	if err != nil {
+		return nil, err
+	}
+	if EstimateTokens(rendered) <= budget {
+		return []string{rendered}, nil
+	}
+	if !hasBlockChild(n) {
+		tag := n.Data
+		if n.Type == html.TextNode {
+			tag = "#text"
+		}
+		return nil, &BlockTooLargeError{Tag: tag, Tokens: EstimateTokens(rendered), Budget: budget}
+	}
+	var blocks []string
+	var inline strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		// The parser makes up an empty <head> for fragments - not worth a block of its own.
+		if c.Type == html.ElementNode && c.Data == "head" && c.FirstChild == nil {
+			continue
+		}
+		if !isBlock(c) {
+			r, err := renderNode(c)
+			if err != nil {
+				return nil, err
+			}
+			inline.WriteString(r)
+			continue
+		}
+		if inline.Len() > 0 {
+			if blocks, err = appendInline(blocks, inline.String(), budget); err != nil {
+				return nil, err
+			}
+			inline.Reset()
+		}
+		sub, err := splitBlocks(c, budget)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, sub...)
+	}
+	if inline.Len() > 0 {
+		if blocks, err = appendInline(blocks, inline.String(), budget); err != nil {
+			return nil, err
+		}
+	}
+	return blocks, nil
+}
+
+// appendInline adds a run of inline content between blocks, which can't be split.
+func appendInline(blocks []string, run string, budget int) ([]string, error) {
+	if strings.TrimSpace(run) == "" {
+		return blocks, nil
+	}
+	if tokens := EstimateTokens(run); tokens > budget {
+		return nil, &BlockTooLargeError{Tag: "#text", Tokens: tokens, Budget: budget}
+	}
+	return append(blocks, run), nil
+}
+
+func hasBlockChild(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if isBlock(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func isBlock(n *html.Node) bool {
+	return n.Type == html.ElementNode && blockTags[n.Data]
+}
+
+func renderNode(n *html.Node) (string, error) {
+	var buf bytes.Buffer
+	if err := html.Render(&buf, n); err != nil {
+		return "", fmt.Errorf("error rendering HTML: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// stripFrontMatter drops a leading TOML front matter block, for every chunk after the first.
+func stripFrontMatter(content string) string {
+	if !strings.HasPrefix(content, "+++\n") {
+		return content
+	}
+	_, rest, found := strings.Cut(content[len("+++\n"):], "+++\n")
+	if !found {
+		return content
+	}
+	return strings.TrimLeft(rest, "\n")
+}
@@ -0,0 +1,87 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChunkHTML(t *testing.T) {
+	para := "<p>" + strings.Repeat("word ", 20) + "</p>" // ~36 tokens each
+	tests := []struct {
+		name        string
+		body        string
+		budget      int
+		expected    int
+		expectedErr error
+	}{
+		{name: "fits", body: "<article>" + para + "</article>", budget: 1000, expected: 1},
+		{name: "split between paragraphs", body: "<article>" + strings.Repeat(para, 6) + "</article>", budget: 80, expected: 3},
+		{name: "nested blocks", body: "<div><section>" + strings.Repeat(para, 2) + "</section><section>" + strings.Repeat(para, 2) + "</section></div>", budget: 80, expected: 2},
+		{name: "single block too large", body: "<article>" + para + "<p>" + strings.Repeat("word ", 100) + "</p></article>", budget: 80, expectedErr: ErrBlockTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := chunkHTML(tt.body, tt.budget)
+			if tt.expectedErr != nil {
+				var btl *BlockTooLargeError
+				if !errors.Is(err, tt.expectedErr) || !errors.As(err, &btl) || btl.Tag != "p" {
+					t.Errorf("expected %v on <p>, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(chunks) != tt.expected {
+				t.Fatalf("expected %d chunks, got %d: %q", tt.expected, len(chunks), chunks)
+			}
+			for _, c := range chunks {
+				if EstimateTokens(c) > tt.budget {
+					t.Errorf("chunk over budget: %q", c)
+				}
+				if strings.Count(c, "<p>") != strings.Count(c, "</p>") {
+					t.Errorf("chunk split a paragraph: %q", c)
+				}
+			}
+		})
+	}
+}
+
+func TestExecPromptForChunked(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html><body><article>" + strings.Repeat("<p>"+strings.Repeat("lorem ", 200)+"</p>", 3) + "</article></body></html>"))
+	}))
+	defer srv.Close()
+
+	fp := &fakeProvider{content: "+++\ntitle = \"Post\"\n+++\n\nsome text\n"}
+	c := NewClient("", WithProvider(fp))
+	pr, err := c.NewPromptRequest(context.Background(), &PromptRequestInput{
+		InputTag:       "blog",
+		OutputTag:      "hugo",
+		HTMLSelector:   "article",
+		MaxInputTokens: EstimateTokens(deepseekSystemRole+deepseekStdPrompt+HugoOutputText+BlogInputText) + 500,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building prompt request: %v", err)
+	}
+	resp, err := c.ExecPromptFor(context.Background(), pr, srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error executing prompt: %v", err)
+	}
+	if resp.Chunks != 3 || len(fp.requests) != 3 || resp.TokensUsed != 3*42 {
+		t.Fatalf("expected 3 chunks, got %d chunks / %d requests / %d tokens", resp.Chunks, len(fp.requests), resp.TokensUsed)
+	}
+	for _, req := range fp.requests {
+		if len(req.Messages) != 2 {
+			t.Errorf("expected each chunk to be its own request, got %d messages", len(req.Messages))
+		}
+	}
+	expected := "+++\ntitle = \"Post\"\n+++\n\nsome text\n\nsome text\n\nsome text\n"
+	if resp.Content != expected {
+		t.Errorf("expected %q, got %q", expected, resp.Content)
+	}
+}
@@ -0,0 +1,138 @@
+//go:generate stringer -type=CleanLevel -linecomment -output clean_level_string.go
+package autoklept
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// CleanLevel is how hard we scrub HTML before it's billed as prompt tokens. Cleaning is deterministic - no LLM involved.
+type CleanLevel int
+
+const (
+	// CleanNone sends the HTML exactly as found.
+	CleanNone CleanLevel = iota // None
+	// CleanLight drops elements that are never user content (scripts, styles, SVG paths...) and HTML comments.
+	// Page metadata - JSON-LD and article:* meta tags - is kept, since that's where titles and dates tend to live.
+	CleanLight // Light
+	// CleanAggressive is CleanLight, plus stripping every attribute that doesn't carry meaning and collapsing whitespace.
+	CleanAggressive // Aggressive
+)
+
+var (
+	// boilerplateTags are dropped wholesale at CleanLight and above.
+	boilerplateTags = map[string]bool{
+		"script":   true,
+		"style":    true,
+		"noscript": true,
+		"svg":      true,
+		"template": true,
+		"link":     true,
+		"meta":     true,
+	}
+	// semanticAttrs are the only attributes kept at CleanAggressive.
+	semanticAttrs = map[string]bool{
+		"href":    true,
+		"src":     true,
+		"alt":     true,
+		"title":   true,
+		"colspan": true,
+		"rowspan": true,
+	}
+	// preformattedTags keep their whitespace, since it's part of the content.
+	preformattedTags = map[string]bool{
+		"pre":      true,
+		"code":     true,
+		"textarea": true,
+	}
+)
+
+// cleanHTML scrubs `n` in place, according to `level`.
+func cleanHTML(n *html.Node, level CleanLevel) {
+	if level == CleanNone {
+		return
+	}
+	if level >= CleanAggressive && n.Type == html.ElementNode {
+		n.Attr = keepSemanticAttrs(n.Attr)
+	}
+	cleanChildren(n, level, n.Type == html.ElementNode && preformattedTags[n.Data])
+}
+
+func cleanChildren(n *html.Node, level CleanLevel, preformatted bool) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch c.Type {
+		case html.CommentNode:
+			n.RemoveChild(c)
+		case html.ElementNode:
+			if isMetadata(c) {
+				break // Left exactly as it is, attributes and whitespace and all.
+			}
+			if boilerplateTags[c.Data] {
+				n.RemoveChild(c)
+				break
+			}
+			if level >= CleanAggressive {
+				c.Attr = keepSemanticAttrs(c.Attr)
+			}
+			cleanChildren(c, level, preformatted || preformattedTags[c.Data])
+		case html.TextNode:
+			if level < CleanAggressive || preformatted {
+				break
+			}
+			// Dropping elements leaves neighbouring text nodes behind, which would otherwise each keep a space.
+			if prev := c.PrevSibling; prev != nil && prev.Type == html.TextNode {
+				prev.Data = collapseWhitespace(prev.Data + c.Data)
+				n.RemoveChild(c)
+			} else {
+				c.Data = collapseWhitespace(c.Data)
+			}
+		}
+		c = next
+	}
+}
+
+// isMetadata reports whether `n` is structured page metadata, e.g. a blog's datePublished, rather than boilerplate.
+func isMetadata(n *html.Node) bool {
+	switch n.Data {
+	case "script":
+		return strings.EqualFold(strings.TrimSpace(getAttr(n, "type")), "application/ld+json")
+	case "meta":
+		return strings.HasPrefix(getAttr(n, "property"), "article:")
+	}
+	return false
+}
+
+func keepSemanticAttrs(attrs []html.Attribute) []html.Attribute {
+	var kept []html.Attribute
+	for _, a := range attrs {
+		if !semanticAttrs[a.Key] {
+			continue
+		}
+		// Inlined base64 images can be enormous, and the LLM can't do anything with them anyway.
+		if a.Key == "src" && strings.HasPrefix(a.Val, "data:") {
+			continue
+		}
+		kept = append(kept, a)
+	}
+	return kept
+}
+
+// collapseWhitespace squashes runs of whitespace down to a single space, like a browser would render them.
+func collapseWhitespace(s string) string {
+	var sb strings.Builder
+	inSpace := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			if !inSpace {
+				sb.WriteByte(' ')
+			}
+			inSpace = true
+			continue
+		}
+		inSpace = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,55 @@
+package autoklept
+
+import (
+	"testing"
+)
+
+func TestCleanHTML(t *testing.T) {
+	page := []byte(`<div class="post" data-track="x" style="color:red"><!-- tracking -->
+<script>var x = 1;</script><style>.a{}</style><noscript>enable js</noscript>
+<script type="application/ld+json">{"datePublished":  "2023-01-02"}</script><meta property="article:published_time" content="2023-01-02"><meta name="viewport" content="width=device-width">
+<h1 id="t"  class="title">Hello    there</h1>
+<svg viewBox="0 0 10 10"><path d="M0 0L10 10"/></svg>
+<p>See <a href="/x" rel="nofollow" target="_blank">this</a> and <img src="data:image/png;base64,AAAA" alt="pic"><img src="/a.png" alt="a" width="10"></p>
+<pre>keep
+   this</pre></div>`)
+	tests := []struct {
+		level    CleanLevel
+		expected string
+	}{
+		{
+			level: CleanLight,
+			expected: `<div class="post" data-track="x" style="color:red">
+
+<script type="application/ld+json">{"datePublished":  "2023-01-02"}</script><meta property="article:published_time" content="2023-01-02"/>
+<h1 id="t" class="title">Hello    there</h1>
+
+<p>See <a href="/x" rel="nofollow" target="_blank">this</a> and <img src="data:image/png;base64,AAAA" alt="pic"/><img src="/a.png" alt="a" width="10"/></p>
+<pre>keep
+   this</pre></div>`,
+		},
+		{
+			level: CleanAggressive,
+			expected: `<div> <script type="application/ld+json">{"datePublished":  "2023-01-02"}</script><meta property="article:published_time" content="2023-01-02"/> <h1>Hello there</h1> <p>See <a href="/x">this</a> and <img alt="pic"/><img src="/a.png" alt="a"/></p> <pre>keep
+   this</pre></div>`,
+		},
+	}
+	uncleaned, _, err := parseHtmlByTag(page, htmlParseOpts{finder: MustParseSelector("div.post")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			buf, before, err := parseHtmlByTag(page, htmlParseOpts{finder: MustParseSelector("div.post"), clean: tt.level})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected\n%s\ngot\n%s", tt.expected, buf.String())
+			}
+			if before != uncleaned.Len() {
+				t.Errorf("expected %d bytes before cleaning, got %d", uncleaned.Len(), before)
+			}
+		})
+	}
+}
@@ -5,46 +5,193 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"net/url"
 	"time"
-
-	"github.com/cohesion-org/deepseek-go"
-	"github.com/cohesion-org/deepseek-go/constants"
 )
 
+// DefaultMaxContinuations is how many times we'll ask for more output, when PromptRequestInput doesn't say.
+const DefaultMaxContinuations = 3
+
 var (
-	ErrNon200ResponseCode = errors.New("non-200 response code when fetching HTML")
+	ErrConflictingFinders = errors.New("only one of HTMLFinder or HTMLSelector may be set")
 )
 
 type Client struct {
-	deepseek *deepseek.Client
+	provider Provider
+	fetcher  Fetcher
 	cfg      *Config
+	// Each stage retries on its own terms - a flaky page isn't a reason to hammer the LLM, or vice versa.
+	pageRetry    RetryPolicy
+	sitemapRetry RetryPolicy
+	chatRetry    RetryPolicy
+	hostLimit    HostRateLimit
+	chatLimit    ChatRateLimit
+	hosts        *hostLimiter // Built from hostLimit, and shared by every fetch the Client makes.
+	chat         *limiter     // Built from chatLimit.
+	// ignoreRobots skips robots.txt checks entirely. Otherwise `robots` vets every page before it's fetched.
+	ignoreRobots bool
+	robots       *robotsChecker
 }
 
 type Config struct {
-	DeepseekAPIKey  string // Generate and monitor usage at https://platform.deepseek.com/usage.
+	DeepseekAPIKey string // Generate and monitor usage at https://platform.deepseek.com/usage.
+	// DeepseekTimeout bounds each chat completion attempt, whichever provider is behind it.
 	DeepseekTimeout time.Duration
+	// FetchTimeout bounds each attempt at fetching a page, sitemap or feed.
+	FetchTimeout time.Duration
+	// URLTimeout bounds a whole ExecPromptFor* call: every fetch, chunk, continuation and retry. 0 means no limit.
+	URLTimeout time.Duration
 }
 
 func NewClient(apiKey string, opts ...ClientOption) *Client {
-	c := &Client{deepseek: deepseek.NewClient(apiKey)}
-	c.cfg = &Config{DeepseekAPIKey: apiKey}
+	c := &Client{
+		cfg:          &Config{DeepseekAPIKey: apiKey, DeepseekTimeout: DefaultChatTimeout, FetchTimeout: DefaultFetchTimeout},
+		pageRetry:    DefaultRetryPolicy,
+		sitemapRetry: DefaultRetryPolicy,
+		chatRetry:    DefaultRetryPolicy,
+	}
 	for _, opt := range opts {
 		opt(c)
 	}
+	// DeepSeek is the default, if nobody gave us something else.
+	if c.provider == nil {
+		c.provider = NewDeepseekProvider(apiKey)
+	}
+	if c.fetcher == nil {
+		c.fetcher = defaultFetcher
+	}
+	// robots.txt is matched against whatever User-Agent we actually send, if the Fetcher will tell us.
+	userAgent := DefaultUserAgent
+	if ua, ok := c.fetcher.(interface{ UserAgent() string }); ok {
+		userAgent = ua.UserAgent()
+	}
+	c.hosts = newHostLimiter(c.hostLimit)
+	c.chat = newLimiter(c.chatLimit.RequestsPerSecond, c.chatLimit.MaxConcurrent, 0)
+	if !c.ignoreRobots {
+		c.robots = newRobotsChecker(c.sourceFetcher(), userAgent, func(host string, d time.Duration) {
+			c.hosts.forHost(host).setMinInterval(d)
+		})
+	}
 	return c
 }
 
 type ClientOption func(*Client)
 
+// WithTimeout sets Config.DeepseekTimeout, the deadline for each chat completion attempt.
 func WithTimeout(timeout time.Duration) ClientOption {
 	return func(client *Client) {
 		client.cfg.DeepseekTimeout = timeout
 	}
 }
 
-func (c *Client) BuildURLs(ctx context.Context, sourceURLs, sitemapURLs []string) ([]url.URL, error) {
+// WithFetchTimeout sets Config.FetchTimeout, the deadline for each attempt at fetching a page, sitemap or feed.
+func WithFetchTimeout(timeout time.Duration) ClientOption {
+	return func(client *Client) {
+		client.cfg.FetchTimeout = timeout
+	}
+}
+
+// WithURLTimeout sets Config.URLTimeout, the deadline for everything it takes to extract a single page.
+func WithURLTimeout(timeout time.Duration) ClientOption {
+	return func(client *Client) {
+		client.cfg.URLTimeout = timeout
+	}
+}
+
+// WithProvider swaps out the LLM backend used for extraction, e.g. for a different model or a fake in tests.
+func WithProvider(p Provider) ClientOption {
+	return func(client *Client) {
+		client.provider = p
+	}
+}
+
+// WithoutProvider is for Clients that only ever fetch - sitemaps, feeds, crawls - so there's no LLM to configure.
+// Any extraction fails with ErrNoProvider.
+func WithoutProvider() ClientOption {
+	return func(client *Client) {
+		client.provider = noProvider{}
+	}
+}
+
+// WithFetcher swaps out how pages, sitemaps and feeds are fetched, e.g. for a custom User-Agent or http.Client.
+func WithFetcher(f Fetcher) ClientOption {
+	return func(client *Client) {
+		client.fetcher = f
+	}
+}
+
+// WithRetry sets the same RetryPolicy for page fetches, sitemap / feed fetches and chat completions.
+func WithRetry(p RetryPolicy) ClientOption {
+	return func(client *Client) {
+		client.pageRetry, client.sitemapRetry, client.chatRetry = p, p, p
+	}
+}
+
+// WithPageRetry sets the RetryPolicy for fetching the pages we extract from.
+func WithPageRetry(p RetryPolicy) ClientOption {
+	return func(client *Client) {
+		client.pageRetry = p
+	}
+}
+
+// WithSitemapRetry sets the RetryPolicy for fetching sitemaps, feeds, robots.txt and crawled pages.
+func WithSitemapRetry(p RetryPolicy) ClientOption {
+	return func(client *Client) {
+		client.sitemapRetry = p
+	}
+}
+
+// WithChatRetry sets the RetryPolicy for LLM chat completions.
+func WithChatRetry(p RetryPolicy) ClientOption {
+	return func(client *Client) {
+		client.chatRetry = p
+	}
+}
+
+// WithHostRateLimit throttles every fetch per host, so a parallel batch doesn't get us banned.
+func WithHostRateLimit(l HostRateLimit) ClientOption {
+	return func(client *Client) {
+		client.hostLimit = l
+	}
+}
+
+// WithChatRateLimit throttles LLM calls, e.g. to stay under a provider's rate limits.
+func WithChatRateLimit(l ChatRateLimit) ClientOption {
+	return func(client *Client) {
+		client.chatLimit = l
+	}
+}
+
+// WithRobotsTxt turns robots.txt checks on or off. They're on by default: pages a site's robots.txt disallows for
+// our User-Agent fail with ErrDisallowedByRobots, and any Crawl-delay slows down our requests to it.
+func WithRobotsTxt(respect bool) ClientOption {
+	return func(client *Client) {
+		client.ignoreRobots = !respect
+	}
+}
+
+// RobotsAllowed reports whether robots.txt lets us fetch `u`. It's always true with WithRobotsTxt(false).
+// While the host's robots.txt can't be reached, it's false with ErrRobotsUnreachable rather than a disallow - that
+// might well have cleared up by the time the page is fetched.
+func (c *Client) RobotsAllowed(ctx context.Context, u string) (bool, error) {
+	if c.robots == nil {
+		return true, nil
+	}
+	uParsed, err := url.Parse(u)
+	if err != nil {
+		return false, fmt.Errorf("error parsing URL: %w", err)
+	}
+	return c.robots.allowed(ctx, uParsed)
+}
+
+// sourceFetcher is the Client's Fetcher, retrying as configured for sitemaps, feeds and crawling.
+func (c *Client) sourceFetcher() Fetcher {
+	return retryingFetcher{fetcher: c.fetcher, policy: c.sitemapRetry, timeout: c.cfg.FetchTimeout, hosts: c.hosts}
+}
+
+// BuildURLs gathers the URLs to extract: `sourceURLs` as given, plus whatever `filter` keeps from the sitemaps.
+// A nil filter keeps everything. Sitemap children that fail are skipped, and reported in a *SitemapChildrenError.
+func (c *Client) BuildURLs(ctx context.Context, sourceURLs, sitemapURLs []string, filter *URLFilter) ([]url.URL, error) {
 	var urls []url.URL
 	for _, uStr := range sourceURLs {
 		u, err := url.Parse(uStr)
@@ -53,12 +200,21 @@ func (c *Client) BuildURLs(ctx context.Context, sourceURLs, sitemapURLs []string
 		}
 		urls = append(urls, *u)
 	}
+	var skipped []error
 	for _, smUrl := range sitemapURLs {
-		found, err := ParseSitemapURLs(ctx, smUrl)
+		// Entries rather than bare URLs, so the filter gets their lastmods.
+		found, err := c.ParseSitemapEntries(ctx, smUrl)
+		failed, err := childErrors(err)
 		if err != nil {
 			return nil, fmt.Errorf("error parsing sitemap URL: %w", err)
 		}
-		urls = append(urls, found...)
+		skipped = append(skipped, failed...)
+		for _, e := range filter.FilterSitemapEntries(found) {
+			urls = append(urls, e.Loc)
+		}
+	}
+	if len(skipped) > 0 {
+		return urls, &SitemapChildrenError{Errs: skipped}
 	}
 	return urls, nil
 }
@@ -72,27 +228,75 @@ func (c *Client) NewPromptRequest(ctx context.Context, reqInput *PromptRequestIn
 	if err != nil {
 		return nil, err
 	}
-	// This does not have the input HTML attached to it yet
-	// The PromptRequest might be the same other than that HTML, so we need only make one.
-	// This is meant to capture autoklept's best practices for how to query DeepSeek for best extraction.
-	ccr := deepseek.ChatCompletionRequest{
-		// This actually perform better than the deepseek-reasoner at clean extraction. Hilarious.
-		Model:    deepseek.DeepSeekChat,
-		Messages: []deepseek.ChatCompletionMessage{{Role: constants.ChatMessageRoleSystem, Content: deepseekSystemRole}},
-	}
-	var nf *ElementNodeFinder
-	if reqInput.HTMLFinder != nil {
-		nf = &ElementNodeFinder{
+	// This does not have the input HTML attached to it - ExecPromptFor adds that to a copy on every call.
+	// This is meant to capture autoklept's best practices for how to query an LLM for best extraction.
+	chat := ChatRequest{
+		Messages: []ChatMessage{{Role: ChatRoleSystem, Content: deepseekSystemRole}},
+	}
+	var nf NodeFinder
+	switch {
+	case reqInput.HTMLFinder != nil && reqInput.HTMLSelector != "":
+		return nil, ErrConflictingFinders
+	case reqInput.HTMLFinder != nil:
+		nf = ElementNodeFinder{
 			Tag:     reqInput.HTMLFinder.Tag,
 			AttrKey: reqInput.HTMLFinder.AttrKey,
 			AttrVal: reqInput.HTMLFinder.AttrVal,
 		}
+	case reqInput.HTMLSelector != "":
+		sel, err := ParseSelector(reqInput.HTMLSelector)
+		if err != nil {
+			return nil, err
+		}
+		nf = sel
+	}
+	var fallbacks []NodeFinder
+	for _, fb := range reqInput.HTMLFallbackSelectors {
+		sel, err := ParseSelector(fb)
+		if err != nil {
+			return nil, err
+		}
+		fallbacks = append(fallbacks, sel)
+	}
+	var onNotFound FallbackPolicy
+	if reqInput.OnNotFound != "" {
+		if onNotFound, err = Validate[FallbackPolicy](reqInput.OnNotFound); err != nil {
+			return nil, err
+		}
+	}
+	var excludes []NodeMatcher
+	for _, ex := range reqInput.HTMLExclude {
+		sel, err := ParseSelector(ex)
+		if err != nil {
+			return nil, err
+		}
+		excludes = append(excludes, sel)
+	}
+	var clean CleanLevel
+	if reqInput.CleanLevel != "" {
+		if clean, err = Validate[CleanLevel](reqInput.CleanLevel); err != nil {
+			return nil, err
+		}
+	}
+	maxContinuations := reqInput.MaxContinuations
+	if maxContinuations == 0 {
+		maxContinuations = DefaultMaxContinuations
 	}
 	return &PromptRequest{
 		prompt:     buildPromptString(in, out),
 		systemRole: deepseekSystemRole,
-		ccr:        ccr,
-		nodeFinder: nf,
+		output:     out,
+		chat:       chat,
+		htmlOpts: htmlParseOpts{
+			finder:     nf,
+			fallbacks:  fallbacks,
+			onNotFound: onNotFound,
+			matchAll:   reqInput.HTMLMatchAll,
+			excludes:   excludes,
+			clean:      clean,
+		},
+		maxInputTokens:   reqInput.MaxInputTokens,
+		maxContinuations: max(maxContinuations, 0),
 	}, nil
 }
 
@@ -102,51 +306,130 @@ func (c *Client) ExecPromptFor(ctx context.Context, pr *PromptRequest, u string)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing sitemap URL: %w", err)
 	}
-	// Get HTML from URL and parse as desired
-	htmlResp, err := httpGet(ctx, uParsed)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching HTML from URL: %w", err)
-	}
-	// TODO: fork depending on pr.nodeFinder existing should happen here, probably
-	parsedHtml, err := parseHtmlByTag(htmlResp, pr.nodeFinder)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing HTML: %w", err)
+	return withDeadline(ctx, c.cfg.URLTimeout, ErrURLTimeout, func(ctx context.Context) (*PromptResponse, error) {
+		if c.robots != nil {
+			allowed, err := c.robots.allowed(ctx, uParsed)
+			if err != nil {
+				return nil, fmt.Errorf("error checking robots.txt: %w", err)
+			}
+			if !allowed {
+				return nil, fmt.Errorf("%w: %s", ErrDisallowedByRobots, u)
+			}
+		}
+		// Get HTML from URL and parse as desired
+		htmlResp, attempts, err := retry(ctx, c.pageRetry, func() ([]byte, error) {
+			return fetchAttempt(ctx, c.fetcher, c.hosts, c.cfg.FetchTimeout, uParsed)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error fetching HTML from URL after %d attempt(s): %w", attempts, err)
+		}
+		// Links are left as the page has them. Only ExecPromptForHTML resolves them, given a base URL.
+		prsp, err := c.execPrompt(ctx, pr, htmlResp, nil)
+		if err != nil {
+			return nil, err
+		}
+		prsp.FetchAttempts = attempts
+		return prsp, nil
+	})
+}
+
+// ExecPromptForHTML is ExecPromptFor for HTML you already have, e.g. from your own crawler or an archive.
+// Relative links are resolved against `baseURL`, if given - otherwise they're left as they are.
+func (c *Client) ExecPromptForHTML(ctx context.Context, pr *PromptRequest, body []byte, baseURL string) (*PromptResponse, error) {
+	var base *url.URL
+	if baseURL != "" {
+		var err error
+		if base, err = url.Parse(baseURL); err != nil {
+			return nil, fmt.Errorf("error parsing base URL: %w", err)
+		}
 	}
-	pr.setPromptWithBytes(parsedHtml)
-	resp, err := c.deepseek.CreateChatCompletion(ctx, &pr.ccr)
+	return withDeadline(ctx, c.cfg.URLTimeout, ErrURLTimeout, func(ctx context.Context) (*PromptResponse, error) {
+		return c.execPrompt(ctx, pr, body, base)
+	})
+}
+
+// ExecPromptForReader is ExecPromptForHTML, reading the HTML from `r`.
+func (c *Client) ExecPromptForReader(ctx context.Context, pr *PromptRequest, r io.Reader, baseURL string) (*PromptResponse, error) {
+	body, err := io.ReadAll(r)
 	if err != nil {
-		return nil, fmt.Errorf("error querying DeepSeek: %w", err)
+		return nil, fmt.Errorf("error reading HTML: %w", err)
 	}
-	return newPromptResponse(resp), nil
+	return c.ExecPromptForHTML(ctx, pr, body, baseURL)
 }
 
-// ParseSitemapURLs doesn't require any LLM
-func ParseSitemapURLs(ctx context.Context, sitemapURL string) ([]url.URL, error) {
-	u, err := url.Parse(sitemapURL)
+// execPrompt is the path every ExecPromptFor* takes once it has the page: find, clean, chunk, and prompt.
+func (c *Client) execPrompt(ctx context.Context, pr *PromptRequest, htmlResp []byte, base *url.URL) (*PromptResponse, error) {
+	opts := pr.htmlOpts
+	opts.base = base
+	parsedHtml, uncleaned, err := parseHtmlByTag(htmlResp, opts)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing sitemap URL: %w", err)
+		return nil, fmt.Errorf("error parsing HTML: %w", err)
 	}
-	sitemapRaw, err := httpGet(ctx, u)
-	if err != nil {
-		return nil, fmt.Errorf("error getting sitemap from URL: %w", err)
+	chunks := []string{parsedHtml.String()}
+	if pr.maxInputTokens > 0 {
+		budget, err := pr.htmlBudget()
+		if err != nil {
+			return nil, err
+		}
+		if chunks, err = chunkHTML(parsedHtml.String(), budget); err != nil {
+			return nil, fmt.Errorf("error chunking HTML: %w", err)
+		}
 	}
-	return extractUrlSet(sitemapRaw)
+	prsp := &PromptResponse{PageBytes: len(htmlResp), HTMLBytesBefore: uncleaned, HTMLBytesAfter: parsedHtml.Len()}
+	for i, chunk := range chunks {
+		resp, continuations, attempts, err := c.completeChat(ctx, pr.chatRequestFor(chunk), pr.maxContinuations, pr.maxInputTokens)
+		prsp.ChatAttempts += attempts
+		if err != nil {
+			return nil, fmt.Errorf("error querying LLM provider (chunk %d of %d, %d attempt(s)): %w", i+1, len(chunks), prsp.ChatAttempts, err)
+		}
+		prsp.addChunk(resp, pr.output)
+		prsp.Continuations += continuations
+	}
+	return prsp, nil
 }
 
-func httpGet(ctx context.Context, u *url.URL) ([]byte, error) {
-	req := &http.Request{URL: u, Method: http.MethodGet}
-	req = req.WithContext(ctx)
-	resp, err := http.DefaultClient.Do(req)
+// completeChat sends `req`, and keeps asking the model to carry on for as long as it stops at its output token limit,
+// up to `maxContinuations` times. The returned response has everything stitched together. Every request is retried
+// per the chat RetryPolicy, and the attempts across all of them are counted.
+// Each continuation re-sends the output so far, so they also stop once that would take a request over
+// `maxInputTokens` (if it's set), leaving the output truncated rather than overflowing the context.
+func (c *Client) completeChat(ctx context.Context, req *ChatRequest, maxContinuations, maxInputTokens int) (*ChatResponse, int, int, error) {
+	resp, attempts, err := c.createChat(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("error on HTTP request: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-	if resp.StatusCode != http.StatusOK {
-		return nil, ErrNon200ResponseCode
+		return nil, 0, attempts, err
 	}
-	bs, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	continuations := 0
+	for resp.FinishReason == FinishReasonLength && continuations < maxContinuations {
+		cont := continuationFor(req, resp.Content)
+		if maxInputTokens > 0 && cont.estimateTokens() > maxInputTokens {
+			break
+		}
+		next, n, err := c.createChat(ctx, cont)
+		attempts += n
+		if err != nil {
+			return nil, continuations, attempts, fmt.Errorf("error continuing truncated output: %w", err)
+		}
+		continuations++
+		resp = &ChatResponse{
+			Content:          resp.Content + next.Content,
+			ReasoningContent: resp.ReasoningContent + next.ReasoningContent,
+			TokensUsed:       resp.TokensUsed + next.TokensUsed,
+			FinishReason:     next.FinishReason,
+		}
 	}
-	return bs, nil
+	return resp, continuations, attempts, nil
+}
+
+func (c *Client) createChat(ctx context.Context, req *ChatRequest) (*ChatResponse, int, error) {
+	return retry(ctx, c.chatRetry, func() (*ChatResponse, error) {
+		// Waiting our turn doesn't count against the chat timeout.
+		done, err := c.chat.wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+		return withDeadline(ctx, c.cfg.DeepseekTimeout, ErrChatTimeout, func(ctx context.Context) (*ChatResponse, error) {
+			return c.provider.CreateChatCompletion(ctx, req)
+		})
+	})
 }
@@ -0,0 +1,266 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeProvider struct {
+	mu       sync.Mutex
+	requests []ChatRequest
+	content  string
+	// responses are handed out in order, before falling back to `content`.
+	responses []ChatResponse
+}
+
+func (f *fakeProvider) CreateChatCompletion(_ context.Context, req *ChatRequest) (*ChatResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, *req)
+	if len(f.responses) > 0 {
+		resp := f.responses[0]
+		f.responses = f.responses[1:]
+		return &resp, nil
+	}
+	return &ChatResponse{Content: f.content, TokensUsed: 42, FinishReason: FinishReasonStop}, nil
+}
+
+func TestExecPromptFor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html><body><div id="nav">skip me</div><div id="post"><p>hello world</p></div></body></html>`))
+	}))
+	defer srv.Close()
+
+	fp := &fakeProvider{content: "hello world"}
+	c := NewClient("", WithProvider(fp))
+	pr, err := c.NewPromptRequest(context.Background(), &PromptRequestInput{
+		InputTag:   "blog",
+		OutputTag:  "markdown",
+		HTMLFinder: &ElementNodeFinder{Tag: "div", AttrKey: "id", AttrVal: "post"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building prompt request: %v", err)
+	}
+	resp, err := c.ExecPromptFor(context.Background(), pr, srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error executing prompt: %v", err)
+	}
+	if resp.Content != "hello world" || resp.TokensUsed != 42 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if len(fp.requests) != 1 {
+		t.Fatalf("expected 1 provider request, got %d", len(fp.requests))
+	}
+	msgs := fp.requests[0].Messages
+	if len(msgs) != 2 || msgs[0].Role != ChatRoleSystem || msgs[1].Role != ChatRoleUser {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	if !strings.Contains(msgs[1].Content, "hello world") || strings.Contains(msgs[1].Content, "skip me") {
+		t.Errorf("user message should contain only the found node, got %q", msgs[1].Content)
+	}
+}
+
+func TestExecPromptForPassesPageThrough(t *testing.T) {
+	page := `<html><head></head><body><a href="/about">about</a></body></html>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	fp := &fakeProvider{content: "ok"}
+	c := NewClient("", WithProvider(fp), WithRobotsTxt(false))
+	pr, err := c.NewPromptRequest(context.Background(), &PromptRequestInput{InputTag: "blog", OutputTag: "markdown"})
+	if err != nil {
+		t.Fatalf("unexpected error building prompt request: %v", err)
+	}
+	if _, err := c.ExecPromptFor(context.Background(), pr, srv.URL); err != nil {
+		t.Fatalf("unexpected error executing prompt: %v", err)
+	}
+	if !strings.Contains(fp.requests[0].Messages[1].Content, page) {
+		t.Errorf("expected the page untouched, got %q", fp.requests[0].Messages[1].Content)
+	}
+}
+
+func TestExecPromptForContinuesTruncatedOutput(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html><body><p>a long post</p></body></html>`))
+	}))
+	defer srv.Close()
+
+	truncated := func(content string) ChatResponse {
+		return ChatResponse{Content: content, TokensUsed: 10, FinishReason: FinishReasonLength}
+	}
+	tests := []struct {
+		name                  string
+		maxContinuations      int
+		maxInputTokens        int
+		responses             []ChatResponse
+		expectedContent       string
+		expectedContinuations int
+		expectedPartial       bool
+	}{
+		{
+			name:                  "completes",
+			responses:             []ChatResponse{truncated("one "), truncated("two "), {Content: "three", FinishReason: FinishReasonStop}},
+			expectedContent:       "one two three",
+			expectedContinuations: 2,
+		},
+		{
+			name:                  "hits the limit",
+			maxContinuations:      1,
+			responses:             []ChatResponse{truncated("one "), truncated("two "), {Content: "three", FinishReason: FinishReasonStop}},
+			expectedContent:       "one two ",
+			expectedContinuations: 1,
+			expectedPartial:       true,
+		},
+		{
+			// The page fits the budget easily, but sending a million bytes of output back to continue it doesn't.
+			name:            "continuation over the input budget",
+			maxInputTokens:  100_000,
+			responses:       []ChatResponse{truncated(strings.Repeat("x", 1_000_000)), {Content: "more", FinishReason: FinishReasonStop}},
+			expectedContent: strings.Repeat("x", 1_000_000),
+			expectedPartial: true,
+		},
+		{
+			name:             "never continues",
+			maxContinuations: -1,
+			responses:        []ChatResponse{truncated("one ")},
+			expectedContent:  "one ",
+			expectedPartial:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fp := &fakeProvider{responses: tt.responses}
+			c := NewClient("", WithProvider(fp))
+			pr, err := c.NewPromptRequest(context.Background(), &PromptRequestInput{InputTag: "blog", OutputTag: "markdown", MaxContinuations: tt.maxContinuations, MaxInputTokens: tt.maxInputTokens})
+			if err != nil {
+				t.Fatalf("unexpected error building prompt request: %v", err)
+			}
+			resp, err := c.ExecPromptFor(context.Background(), pr, srv.URL)
+			if err != nil {
+				t.Fatalf("unexpected error executing prompt: %v", err)
+			}
+			if resp.Content != tt.expectedContent || resp.Continuations != tt.expectedContinuations || resp.Partial != tt.expectedPartial {
+				t.Errorf("expected %q / %d continuations / partial %t, got %q / %d / %t",
+					tt.expectedContent, tt.expectedContinuations, tt.expectedPartial, resp.Content, resp.Continuations, resp.Partial)
+			}
+			if len(fp.requests) != tt.expectedContinuations+1 {
+				t.Fatalf("expected %d requests, got %d", tt.expectedContinuations+1, len(fp.requests))
+			}
+			// Every continuation carries the output so far, then asks for the rest.
+			for i, req := range fp.requests[1:] {
+				msgs := req.Messages
+				if len(msgs) != 4 || msgs[2].Role != ChatRoleAssistant || msgs[3].Content != continuePrompt {
+					t.Errorf("continuation %d: unexpected messages %+v", i+1, msgs)
+				}
+			}
+		})
+	}
+}
+
+// TestExecPromptForConcurrent shares one PromptRequest between goroutines, like the batch does. Run it with -race.
+func TestExecPromptForConcurrent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `<html><body><div id="post"><p>page %s</p></div></body></html>`, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	fp := &fakeProvider{content: "ok"}
+	c := NewClient("", WithProvider(fp))
+	pr, err := c.NewPromptRequest(context.Background(), &PromptRequestInput{
+		InputTag:     "blog",
+		OutputTag:    "markdown",
+		HTMLSelector: "#post",
+		CleanLevel:   "Aggressive",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building prompt request: %v", err)
+	}
+	const pages = 20
+	var wg sync.WaitGroup
+	for i := range pages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.ExecPromptFor(context.Background(), pr, fmt.Sprintf("%s/%d", srv.URL, i)); err != nil {
+				t.Errorf("unexpected error executing prompt: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(fp.requests) != pages {
+		t.Fatalf("expected %d provider requests, got %d", pages, len(fp.requests))
+	}
+	seen := map[string]bool{}
+	for _, req := range fp.requests {
+		if len(req.Messages) != 2 {
+			t.Fatalf("expected only the system and user messages, got %d", len(req.Messages))
+		}
+		if n := strings.Count(req.Messages[1].Content, "page /"); n != 1 {
+			t.Errorf("expected exactly one page in the user message, got %d: %q", n, req.Messages[1].Content)
+		}
+		seen[req.Messages[1].Content] = true
+	}
+	if len(seen) != pages {
+		t.Errorf("expected %d distinct user messages, got %d", pages, len(seen))
+	}
+	// The template itself is never touched.
+	if len(pr.chat.Messages) != 1 {
+		t.Errorf("expected the template to keep just the system message, got %d messages", len(pr.chat.Messages))
+	}
+}
+
+func TestExecPromptForReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     string
+		baseURL  string
+		expected string
+	}{
+		{name: "no base", page: `<div id="post"><a href="/about">about</a></div>`, expected: `<a href="/about">`},
+		{name: "base URL", page: `<div id="post"><a href="/about">about</a><img src="img/cat.png"/></div>`, baseURL: "https://example.com/blog/post", expected: `<a href="https://example.com/about">about</a><img src="https://example.com/blog/img/cat.png"/>`},
+		{name: "base tag wins", page: `<head><base href="https://cdn.example.com/"/></head><div id="post"><img src="cat.png"/></div>`, baseURL: "https://example.com/blog/post", expected: `<img src="https://cdn.example.com/cat.png"/>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fp := &fakeProvider{content: "ok"}
+			c := NewClient("", WithProvider(fp))
+			pr, err := c.NewPromptRequest(context.Background(), &PromptRequestInput{InputTag: "blog", OutputTag: "markdown", HTMLSelector: "#post"})
+			if err != nil {
+				t.Fatalf("unexpected error building prompt request: %v", err)
+			}
+			resp, err := c.ExecPromptForReader(context.Background(), pr, strings.NewReader(tt.page), tt.baseURL)
+			if err != nil {
+				t.Fatalf("unexpected error executing prompt: %v", err)
+			}
+			if resp.Content != "ok" || resp.PageBytes != len(tt.page) {
+				t.Errorf("unexpected response %+v", resp)
+			}
+			if !strings.Contains(fp.requests[0].Messages[1].Content, tt.expected) {
+				t.Errorf("expected user message to contain %q, got %q", tt.expected, fp.requests[0].Messages[1].Content)
+			}
+		})
+	}
+}
+
+func TestNewClientWithoutKey(t *testing.T) {
+	t.Setenv("DEEPSEEK_API_KEY", "")
+	if p, ok := NewClient("").provider.(*DeepseekProvider); !ok || p.client == nil {
+		t.Errorf("expected a usable default DeepSeek provider even without a key, got %+v", p)
+	}
+	c := NewClient("", WithoutProvider())
+	pr, err := c.NewPromptRequest(context.Background(), &PromptRequestInput{InputTag: "blog", OutputTag: "markdown"})
+	if err != nil {
+		t.Fatalf("unexpected error building prompt request: %v", err)
+	}
+	if _, err := c.ExecPromptForHTML(context.Background(), pr, []byte("<p>hi</p>"), ""); !errors.Is(err, ErrNoProvider) {
+		t.Errorf("expected err %v, got %v", ErrNoProvider, err)
+	}
+}
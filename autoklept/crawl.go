@@ -0,0 +1,165 @@
+package autoklept
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// DefaultCrawlMaxDepth is how many links away from a seed we'll go, which reaches most posts via their listings.
+	DefaultCrawlMaxDepth = 3
+	// DefaultCrawlMaxPages is how many pages one crawl will fetch before calling it a day.
+	DefaultCrawlMaxPages = 500
+)
+
+var (
+	ErrNoCrawlSeeds = errors.New("at least one crawl seed URL is required")
+)
+
+// CrawlConfig says where to start crawling a site, and how far to go.
+type CrawlConfig struct {
+	// Seeds are where the crawl starts. Only links to a seed's own host are followed.
+	Seeds []string
+	// MaxDepth is how many links to follow from a seed. 0 means DefaultCrawlMaxDepth; negative fetches only the seeds.
+	MaxDepth int
+	// MaxPages caps how many pages are fetched altogether. 0 means DefaultCrawlMaxPages.
+	MaxPages int
+	// Include, if set, limits the URLs returned to those matching at least one of these patterns (see
+	// URLFilterConfig). Pages that don't match are still followed, so listings and the like can lead the crawl to
+	// the pages you want.
+	Include []string
+	// Exclude patterns rule URLs out entirely - they're neither returned nor followed (seeds are still followed).
+	Exclude []string
+}
+
+// Crawl finds a site's pages by following its links, for sites without a sitemap or a feed.
+// It starts from each seed and follows <a href> links to the same host, breadth first, returning the HTML pages it
+// found in the order it found them. Pages that fail to fetch (other than the seeds themselves) are skipped, as are
+// any robots.txt disallows for DefaultUserAgent, and any pages on a host whose robots.txt can't be reached.
+func Crawl(ctx context.Context, cfg CrawlConfig) ([]url.URL, error) {
+	return crawl(ctx, defaultSourceFetcher, newRobotsChecker(defaultSourceFetcher, DefaultUserAgent, nil), cfg)
+}
+
+// Crawl is the package-level Crawl, fetching with the Client's Fetcher and sticking to its robots.txt settings
+// and rate limits.
+func (c *Client) Crawl(ctx context.Context, cfg CrawlConfig) ([]url.URL, error) {
+	return crawl(ctx, c.sourceFetcher(), c.robots, cfg)
+}
+
+// crawlPage is a page waiting to be fetched, and how many links it took to get to it.
+type crawlPage struct {
+	u     *url.URL
+	depth int
+}
+
+// crawl does the work of Crawl. A nil `robots` checks nothing.
+func crawl(ctx context.Context, f Fetcher, robots *robotsChecker, cfg CrawlConfig) ([]url.URL, error) {
+	if len(cfg.Seeds) == 0 {
+		return nil, ErrNoCrawlSeeds
+	}
+	include, err := compileURLPatterns(cfg.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileURLPatterns(cfg.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	maxDepth, maxPages := cfg.MaxDepth, cfg.MaxPages
+	if maxDepth == 0 {
+		maxDepth = DefaultCrawlMaxDepth
+	}
+	if maxPages <= 0 {
+		maxPages = DefaultCrawlMaxPages
+	}
+
+	seen := map[string]bool{}
+	hosts := map[string]bool{}
+	var queue []crawlPage
+	for _, s := range cfg.Seeds {
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("error parsing crawl seed '%s': not an absolute http(s) URL", s)
+		}
+		u.Fragment, u.RawFragment = "", ""
+		hosts[strings.ToLower(u.Host)] = true
+		if !seen[u.String()] {
+			seen[u.String()] = true
+			queue = append(queue, crawlPage{u: u})
+		}
+	}
+
+	var found []url.URL
+	for fetched := 0; len(queue) > 0 && fetched < maxPages; {
+		p := queue[0]
+		queue = queue[1:]
+		if robots != nil {
+			allowed, err := robots.allowed(ctx, p.u)
+			if err != nil && !errors.Is(err, ErrRobotsUnreachable) {
+				return nil, fmt.Errorf("error checking robots.txt: %w", err)
+			}
+			if !allowed {
+				continue
+			}
+		}
+		fetched++
+		body, err := f.Fetch(ctx, p.u)
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case err != nil && p.depth == 0:
+			return nil, fmt.Errorf("error fetching crawl seed: %w", err)
+		case err != nil:
+			continue // A dead link isn't the crawl's problem.
+		}
+		if !strings.HasPrefix(http.DetectContentType(body), "text/html") {
+			continue
+		}
+		if matchesAnyPattern(p.u, include, true) && !matchesAnyPattern(p.u, exclude, false) {
+			found = append(found, *p.u)
+		}
+		if p.depth >= maxDepth {
+			continue
+		}
+		doc, err := html.Parse(bytes.NewReader(body))
+		if err != nil {
+			continue
+		}
+		for _, link := range pageLinks(doc, documentBase(doc, p.u)) {
+			key := link.String()
+			if seen[key] || !hosts[strings.ToLower(link.Host)] || matchesAnyPattern(link, exclude, false) {
+				continue
+			}
+			seen[key] = true
+			queue = append(queue, crawlPage{u: link, depth: p.depth + 1})
+		}
+	}
+	return found, nil
+}
+
+// pageLinks finds every <a href> under `n` worth crawling - absolute, http(s), and without the #fragment.
+func pageLinks(n *html.Node, base *url.URL) []*url.URL {
+	var links []*url.URL
+	if n.Type == html.ElementNode && n.Data == "a" {
+		if href, ok := lookupAttr(n, "href"); ok {
+			if ref, err := url.Parse(strings.TrimSpace(href)); err == nil {
+				u := base.ResolveReference(ref)
+				u.Fragment, u.RawFragment = "", ""
+				if u.Scheme == "http" || u.Scheme == "https" {
+					links = append(links, u)
+				}
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		links = append(links, pageLinks(c, base)...)
+	}
+	return links
+}
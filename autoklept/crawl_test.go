@@ -0,0 +1,118 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCrawl(t *testing.T) {
+	pages := map[string]string{
+		"/robots.txt": "User-agent: *\nDisallow: /private\n",
+		"/": `<html><body>
+			<a href="/blog/">Blog</a> <a href="/about#team">About</a> <a href="/about">About again</a>
+			<a href="https://elsewhere.example.com/">Elsewhere</a> <a href="mailto:me@example.com">Mail</a>
+			<a href="/private/drafts">Drafts</a> <a href="/missing">Gone</a> <a href="/cv.pdf">CV</a>
+		</body></html>`,
+		"/blog/":          `<html><body><a href="first">First</a> <a href="/blog/second">Second</a> <a href="/tags/go">Go</a></body></html>`,
+		"/blog/first":     `<html><body><a href="/blog/deep">Deep</a></body></html>`,
+		"/blog/second":    `<html><body><p>Second post</p></body></html>`,
+		"/blog/deep":      `<html><body><p>Too far down</p></body></html>`,
+		"/tags/go":        `<html><body><p>Tag page</p></body></html>`,
+		"/about":          `<html><head><base href="/people/"></head><body><a href="jane">Jane</a></body></html>`,
+		"/people/jane":    `<html><body><p>Jane</p></body></html>`,
+		"/private/drafts": `<html><body><p>Secret</p></body></html>`,
+		"/cv.pdf":         "%PDF-1.4 not a page",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name        string
+		cfg         CrawlConfig
+		expected    []string // Paths, relative to the test server.
+		expectedErr error
+	}{
+		{
+			name:     "defaults",
+			cfg:      CrawlConfig{},
+			expected: []string{"/", "/blog/", "/about", "/blog/first", "/blog/second", "/tags/go", "/people/jane", "/blog/deep"},
+		},
+		{
+			name:     "max depth",
+			cfg:      CrawlConfig{MaxDepth: 1},
+			expected: []string{"/", "/blog/", "/about"},
+		},
+		{
+			name:     "seeds only",
+			cfg:      CrawlConfig{MaxDepth: -1},
+			expected: []string{"/"},
+		},
+		{
+			name:     "max pages",
+			cfg:      CrawlConfig{MaxPages: 2},
+			expected: []string{"/", "/blog/"},
+		},
+		{
+			name:     "include and exclude",
+			cfg:      CrawlConfig{Include: []string{`/blog/.+`}, Exclude: []string{`/deep$`, `/about`}},
+			expected: []string{"/blog/first", "/blog/second"},
+		},
+		{
+			name:     "globs",
+			cfg:      CrawlConfig{Include: []string{"glob:/blog/*"}, Exclude: []string{"glob:/tags/**", "glob:/about"}},
+			expected: []string{"/blog/", "/blog/first", "/blog/second", "/blog/deep"},
+		},
+		{
+			name:        "bad pattern",
+			cfg:         CrawlConfig{Include: []string{`(`}},
+			expectedErr: ErrInvalidURLPattern,
+		},
+		{
+			name:        "dead seed",
+			cfg:         CrawlConfig{Seeds: []string{srv.URL + "/missing"}},
+			expectedErr: ErrNon200ResponseCode,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cfg.Seeds == nil {
+				tt.cfg.Seeds = []string{srv.URL + "/"}
+			}
+			found, err := Crawl(context.Background(), tt.cfg)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("expected err %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var actual []string
+			for _, u := range found {
+				actual = append(actual, strings.TrimPrefix(u.String(), srv.URL))
+			}
+			if !slices.Equal(actual, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCrawlNoSeeds(t *testing.T) {
+	if _, err := Crawl(context.Background(), CrawlConfig{}); !errors.Is(err, ErrNoCrawlSeeds) {
+		t.Errorf("expected err %v, got %v", ErrNoCrawlSeeds, err)
+	}
+}
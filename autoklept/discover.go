@@ -0,0 +1,110 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrNoSitemapFound = errors.New("no sitemap found")
+)
+
+// wellKnownSitemapPaths are probed, in order, when robots.txt doesn't tell us where the sitemap is.
+var wellKnownSitemapPaths = []string{"/sitemap.xml", "/sitemap_index.xml", "/wp-sitemap.xml"}
+
+// DiscoverSitemaps finds the sitemap(s) for a site, given just its root (e.g. "example.com" or "https://example.com").
+// Sitemap: directives in robots.txt win. Failing that, we probe the usual suspects and return the first real sitemap,
+// since on most sites they're all the same sitemap under different names.
+func DiscoverSitemaps(ctx context.Context, site string) ([]string, error) {
+	return discoverSitemaps(ctx, defaultSourceFetcher, site)
+}
+
+// DiscoverSitemaps is the package-level DiscoverSitemaps, fetching with the Client's Fetcher.
+func (c *Client) DiscoverSitemaps(ctx context.Context, site string) ([]string, error) {
+	return discoverSitemaps(ctx, c.sourceFetcher(), site)
+}
+
+func discoverSitemaps(ctx context.Context, f Fetcher, site string) ([]string, error) {
+	root, err := siteRoot(site)
+	if err != nil {
+		return nil, err
+	}
+	// A missing or broken robots.txt is common and fine - we just fall through to probing.
+	if robots, err := f.Fetch(ctx, root.JoinPath("/robots.txt")); err == nil {
+		if found := parseRobots(robots).sitemaps; len(found) > 0 {
+			return found, nil
+		}
+	}
+	for _, p := range wellKnownSitemapPaths {
+		candidate := root.JoinPath(p)
+		raw, err := f.Fetch(ctx, candidate)
+		if err != nil {
+			continue
+		}
+		if looksLikeSitemap(raw) {
+			return []string{candidate.String()}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w for %s", ErrNoSitemapFound, root.String())
+}
+
+// DiscoverSitemapURLs is DiscoverSitemaps followed by ParseSitemapURLs on everything found. As with ParseSitemapURLs,
+// a *SitemapChildrenError comes back with the URLs we did get.
+func DiscoverSitemapURLs(ctx context.Context, site string) ([]url.URL, error) {
+	return discoverSitemapURLs(ctx, defaultSourceFetcher, site)
+}
+
+// DiscoverSitemapURLs is the package-level DiscoverSitemapURLs, fetching with the Client's Fetcher.
+func (c *Client) DiscoverSitemapURLs(ctx context.Context, site string) ([]url.URL, error) {
+	return discoverSitemapURLs(ctx, c.sourceFetcher(), site)
+}
+
+func discoverSitemapURLs(ctx context.Context, f Fetcher, site string) ([]url.URL, error) {
+	sitemaps, err := discoverSitemaps(ctx, f, site)
+	if err != nil {
+		return nil, err
+	}
+	var urls []url.URL
+	var skipped []error
+	for _, sm := range sitemaps {
+		found, err := parseSitemapURLs(ctx, f, sm)
+		failed, err := childErrors(err)
+		if err != nil {
+			return nil, err
+		}
+		skipped = append(skipped, failed...)
+		urls = append(urls, found...)
+	}
+	if len(skipped) > 0 {
+		return urls, &SitemapChildrenError{Errs: skipped}
+	}
+	return urls, nil
+}
+
+// siteRoot reduces whatever the user gave us to scheme + host, assuming https if they left the scheme off.
+func siteRoot(site string) (*url.URL, error) {
+	if !strings.Contains(site, "://") {
+		site = "https://" + site
+	}
+	u, err := url.Parse(site)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing site URL: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("error parsing site URL: no host in '%s'", site)
+	}
+	return &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}, nil
+}
+
+// looksLikeSitemap guards against probes that "succeed" with a 200 soft-404 page.
+func looksLikeSitemap(raw []byte) bool {
+	raw, err := maybeGunzip(raw)
+	if err != nil {
+		return false
+	}
+	root, err := detectRootElement(raw)
+	return err == nil && (root == sitemapRootURLSet || root == sitemapRootIndex)
+}
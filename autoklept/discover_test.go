@@ -0,0 +1,77 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiscoverSitemaps(t *testing.T) {
+	tests := []struct {
+		name        string
+		pages       map[string]string
+		expected    []string // Paths, relative to the test server.
+		expectedErr error
+	}{
+		{
+			name: "robots",
+			pages: map[string]string{
+				"/robots.txt":  "User-agent: *\nDisallow: /admin # keep out\nSITEMAP: https://cdn.example.com/a.xml\nSitemap: https://cdn.example.com/b.xml\n",
+				"/sitemap.xml": "<urlset></urlset>",
+			},
+			expected: []string{"https://cdn.example.com/a.xml", "https://cdn.example.com/b.xml"},
+		},
+		{
+			name: "probe skips soft 404",
+			pages: map[string]string{
+				"/robots.txt":     "User-agent: *\nDisallow:\n",
+				"/sitemap.xml":    "<html><body>Page not found</body></html>",
+				"/wp-sitemap.xml": "<sitemapindex></sitemapindex>",
+			},
+			expected: []string{"/wp-sitemap.xml"},
+		},
+		{
+			name:        "nothing",
+			pages:       map[string]string{},
+			expectedErr: ErrNoSitemapFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, ok := tt.pages[r.URL.Path]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				_, _ = w.Write([]byte(body))
+			}))
+			defer srv.Close()
+
+			found, err := DiscoverSitemaps(context.Background(), srv.URL+"/some/post")
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("expected err %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(found) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, found)
+			}
+			for i, f := range found {
+				exp := tt.expected[i]
+				if exp[0] == '/' {
+					exp = srv.URL + exp
+				}
+				if f != exp {
+					t.Errorf("expected %s, got %s", exp, f)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package autoklept
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	feedRootRSS  = "rss"
+	feedRootAtom = "feed"
+	feedRootRDF  = "RDF" // RSS 1.0
+)
+
+var (
+	ErrUnknownFeedRoot = errors.New("unknown feed root element")
+)
+
+// FeedEntry is a single RSS item or Atom entry. The metadata is handy for seeding Hugo front matter.
+type FeedEntry struct {
+	Link       url.URL
+	Title      string
+	Published  time.Time // Zero if absent or unparseable.
+	Updated    time.Time // Zero if absent or unparseable. Only Atom really has this.
+	Categories []string
+}
+
+// ParseFeedURLs doesn't require any LLM. It returns the entry links from an RSS or Atom feed, in feed order.
+func ParseFeedURLs(ctx context.Context, feedURL string) ([]url.URL, error) {
+	return parseFeedURLs(ctx, defaultSourceFetcher, feedURL)
+}
+
+// ParseFeedURLs is the package-level ParseFeedURLs, fetching with the Client's Fetcher.
+func (c *Client) ParseFeedURLs(ctx context.Context, feedURL string) ([]url.URL, error) {
+	return parseFeedURLs(ctx, c.sourceFetcher(), feedURL)
+}
+
+func parseFeedURLs(ctx context.Context, f Fetcher, feedURL string) ([]url.URL, error) {
+	entries, err := parseFeedEntries(ctx, f, feedURL)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]url.URL, 0, len(entries))
+	for _, e := range entries {
+		urls = append(urls, e.Link)
+	}
+	return urls, nil
+}
+
+// ParseFeedEntries is ParseFeedURLs, but keeps each entry's title, dates and categories.
+// RSS 2.0, RSS 1.0 (RDF) and Atom are all supported. Entries without a usable link are skipped.
+func ParseFeedEntries(ctx context.Context, feedURL string) ([]FeedEntry, error) {
+	return parseFeedEntries(ctx, defaultSourceFetcher, feedURL)
+}
+
+// ParseFeedEntries is the package-level ParseFeedEntries, fetching with the Client's Fetcher.
+func (c *Client) ParseFeedEntries(ctx context.Context, feedURL string) ([]FeedEntry, error) {
+	return parseFeedEntries(ctx, c.sourceFetcher(), feedURL)
+}
+
+func parseFeedEntries(ctx context.Context, f Fetcher, feedURL string) ([]FeedEntry, error) {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing feed URL: %w", err)
+	}
+	raw, err := f.Fetch(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("error getting feed from URL: %w", err)
+	}
+	return extractFeed(raw, u)
+}
+
+func extractFeed(raw []byte, base *url.URL) ([]FeedEntry, error) {
+	root, err := detectRootElement(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error detecting feed type: %w", err)
+	}
+	switch root {
+	case feedRootRSS, feedRootRDF:
+		return extractRSS(raw, base)
+	case feedRootAtom:
+		return extractAtom(raw, base)
+	default:
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownFeedRoot, root)
+	}
+}
+
+// rssFeed covers both RSS 2.0 (items under <channel>) and RSS 1.0 (items as siblings of <channel>).
+type rssFeed struct {
+	ChannelItems []rssItem `xml:"channel>item"`
+	Items        []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title      string   `xml:"title"`
+	Link       string   `xml:"link"`
+	GUID       rssGUID  `xml:"guid"`
+	PubDate    string   `xml:"pubDate"`
+	DCDate     string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Categories []string `xml:"category"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink string `xml:"isPermaLink,attr"`
+}
+
+// permaLink is the GUID if it's the item's URL, which it is unless isPermaLink says otherwise.
+func (g rssGUID) permaLink() string {
+	if strings.TrimSpace(g.IsPermaLink) == "false" {
+		return ""
+	}
+	return strings.TrimSpace(g.Value)
+}
+
+func extractRSS(raw []byte, base *url.URL) ([]FeedEntry, error) {
+	var feed rssFeed
+	if err := xml.Unmarshal(raw, &feed); err != nil {
+		return nil, fmt.Errorf("error unmarshaling RSS feed: %w", err)
+	}
+	var entries []FeedEntry
+	for _, item := range append(feed.ChannelItems, feed.Items...) {
+		link := strings.TrimSpace(item.Link)
+		if link == "" {
+			// Plenty of feeds only have a permalink GUID.
+			link = item.GUID.permaLink()
+		}
+		u, ok := resolveFeedLink(base, link)
+		if !ok {
+			continue
+		}
+		published := item.PubDate
+		if published == "" {
+			published = item.DCDate
+		}
+		entries = append(entries, FeedEntry{
+			Link:       *u,
+			Title:      strings.TrimSpace(item.Title),
+			Published:  parseFeedDate(published),
+			Categories: trimAll(item.Categories),
+		})
+	}
+	return entries, nil
+}
+
+type atomFeed struct {
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	Links      []atomLink     `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+func extractAtom(raw []byte, base *url.URL) ([]FeedEntry, error) {
+	var feed atomFeed
+	if err := xml.Unmarshal(raw, &feed); err != nil {
+		return nil, fmt.Errorf("error unmarshaling Atom feed: %w", err)
+	}
+	var entries []FeedEntry
+	for _, e := range feed.Entries {
+		u, ok := resolveFeedLink(base, atomAlternateLink(e.Links))
+		if !ok {
+			continue
+		}
+		var cats []string
+		for _, c := range e.Categories {
+			if c.Label != "" {
+				cats = append(cats, c.Label)
+			} else if c.Term != "" {
+				cats = append(cats, c.Term)
+			}
+		}
+		fe := FeedEntry{
+			Link:       *u,
+			Title:      strings.TrimSpace(e.Title),
+			Published:  parseFeedDate(e.Published),
+			Updated:    parseFeedDate(e.Updated),
+			Categories: trimAll(cats),
+		}
+		if fe.Published.IsZero() {
+			fe.Published = fe.Updated
+		}
+		entries = append(entries, fe)
+	}
+	return entries, nil
+}
+
+// atomAlternateLink finds the entry's own page. rel defaults to "alternate" when it's left off.
+func atomAlternateLink(links []atomLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return strings.TrimSpace(l.Href)
+		}
+	}
+	return ""
+}
+
+// resolveFeedLink is false for a missing or unparseable link, whose entry has nothing worth extracting.
+func resolveFeedLink(base *url.URL, link string) (*url.URL, bool) {
+	if link == "" {
+		return nil, false
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, false
+	}
+	return base.ResolveReference(u), true
+}
+
+// feedDateLayouts are RFC 822 in all the ways RSS feeds actually write it, plus Atom's RFC 3339.
+var feedDateLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC822Z,
+	time.RFC822,
+	"2006-01-02",
+}
+
+// parseFeedDate returns the zero time for a missing or unparseable date, so callers treat it as unknown.
+func parseFeedDate(raw string) time.Time {
+	raw = strings.TrimSpace(raw)
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func trimAll(ss []string) []string {
+	var out []string
+	for _, s := range ss {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package autoklept
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestExtractFeed(t *testing.T) {
+	base, _ := url.Parse("https://example.com/feed")
+	tests := []struct {
+		name        string
+		raw         string
+		expected    []FeedEntry
+		expectedErr error
+	}{
+		{
+			name: "rss",
+			raw: `<?xml version="1.0"?><rss version="2.0"><channel><title>Blog</title>
+<item><title> First post </title><link>https://example.com/first</link><pubDate>Tue, 05 Mar 2024 10:15:00 +0000</pubDate><category>go</category><category> llm </category></item>
+<item><title>Second</title><guid isPermaLink="true">/second</guid><pubDate>Wed, 6 Mar 2024 08:00:00 GMT</pubDate></item>
+<item><title>Third</title><guid>https://example.com/third</guid></item>
+<item><title>Not a permalink</title><guid isPermaLink="false">tag:example.com,2024:1</guid></item>
+<item><title>No link at all</title></item>
+</channel></rss>`,
+			expected: []FeedEntry{
+				{Title: "First post", Published: time.Date(2024, 3, 5, 10, 15, 0, 0, time.UTC), Categories: []string{"go", "llm"}},
+				{Title: "Second", Published: time.Date(2024, 3, 6, 8, 0, 0, 0, time.UTC)},
+				{Title: "Third"},
+			},
+		},
+		{
+			name: "atom",
+			raw: `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>Blog</title>
+<entry><title>Atom post</title><link rel="edit" href="/edit/1"/><link href="https://example.com/atom-post"/><updated>2024-03-07T09:00:00Z</updated><category term="hugo"/></entry>
+<entry><title>Edit link only</title><link rel="edit" href="/edit/2"/></entry>
+</feed>`,
+			expected: []FeedEntry{
+				{Title: "Atom post", Published: time.Date(2024, 3, 7, 9, 0, 0, 0, time.UTC), Updated: time.Date(2024, 3, 7, 9, 0, 0, 0, time.UTC), Categories: []string{"hugo"}},
+			},
+		},
+		{
+			name:        "not a feed",
+			raw:         `<urlset></urlset>`,
+			expectedErr: ErrUnknownFeedRoot,
+		},
+	}
+	links := map[string][]string{
+		"rss":  {"https://example.com/first", "https://example.com/second", "https://example.com/third"},
+		"atom": {"https://example.com/atom-post"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := extractFeed([]byte(tt.raw), base)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("expected err %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(entries) != len(tt.expected) {
+				t.Fatalf("expected %d entries, got %d", len(tt.expected), len(entries))
+			}
+			for i, e := range entries {
+				exp := tt.expected[i]
+				if e.Link.String() != links[tt.name][i] {
+					t.Errorf("expected link %s, got %s", links[tt.name][i], e.Link.String())
+				}
+				if e.Title != exp.Title || !e.Published.Equal(exp.Published) || !e.Updated.Equal(exp.Updated) {
+					t.Errorf("expected %+v, got %+v", exp, e)
+				}
+				if len(e.Categories) != len(exp.Categories) {
+					t.Fatalf("expected categories %v, got %v", exp.Categories, e.Categories)
+				}
+				for j := range e.Categories {
+					if e.Categories[j] != exp.Categories[j] {
+						t.Errorf("expected categories %v, got %v", exp.Categories, e.Categories)
+					}
+				}
+			}
+		})
+	}
+}
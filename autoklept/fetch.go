@@ -0,0 +1,139 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// DefaultUserAgent is sent when FetcherConfig doesn't say otherwise. Plenty of sites 403 Go's own.
+	DefaultUserAgent = "Mozilla/5.0 (compatible; autoklept/1.0; +https://github.com/jmontroy90/autoklept)"
+	// DefaultMaxBodyBytes caps how much of a response we'll read, comfortably over the largest sitemap allowed.
+	DefaultMaxBodyBytes = 64 * 1024 * 1024
+	// maxErrorBodyBytes is how much of an error response we keep, which is plenty for the usual error page or JSON.
+	maxErrorBodyBytes = 512
+)
+
+var (
+	ErrNon200ResponseCode = errors.New("non-200 response code when fetching HTML")
+	ErrBodyTooLarge       = errors.New("response body exceeds max size")
+	ErrInvalidHeader      = errors.New("invalid header, expected \"Key: Value\"")
+)
+
+// HTTPStatusError is what a Fetcher returns for anything but a 200. It matches ErrNon200ResponseCode with errors.Is.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Header     http.Header // Notably Retry-After, on a 429 or 503.
+	Body       []byte      // The start of the response body, for whatever explanation the server gave.
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%v: %d %s from %s", ErrNon200ResponseCode, e.StatusCode, http.StatusText(e.StatusCode), e.URL)
+}
+
+func (e *HTTPStatusError) Unwrap() error {
+	return ErrNon200ResponseCode
+}
+
+// Retryable reports whether the server might well answer differently next time, e.g. after rate limiting us.
+func (e *HTTPStatusError) Retryable() bool {
+	return retryableStatuses[e.StatusCode]
+}
+
+// Fetcher gets the raw body behind a URL - pages, sitemaps, feeds and robots.txt all come through here.
+// Swap it out to add caching, read from an archive, or fake the web in tests.
+type Fetcher interface {
+	Fetch(ctx context.Context, u *url.URL) ([]byte, error)
+}
+
+type FetcherConfig struct {
+	// Client does the actual requests, so proxies, redirect policy, TLS and timeouts all go on it.
+	// Nil means http.DefaultClient.
+	Client *http.Client
+	// Header is sent with every request, e.g. cookies or Accept-Language.
+	Header http.Header
+	// UserAgent overrides any User-Agent in Header. Empty means DefaultUserAgent.
+	UserAgent string
+	// MaxBodyBytes fails any response bigger than this with ErrBodyTooLarge. 0 means DefaultMaxBodyBytes.
+	MaxBodyBytes int64
+}
+
+// HTTPFetcher is the default Fetcher, doing plain GETs.
+type HTTPFetcher struct {
+	cfg FetcherConfig
+}
+
+func NewHTTPFetcher(cfg FetcherConfig) *HTTPFetcher {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = DefaultUserAgent
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	return &HTTPFetcher{cfg: cfg}
+}
+
+// UserAgent is what we identify as, which robots.txt rules are matched against too.
+func (f *HTTPFetcher) UserAgent() string {
+	return f.cfg.UserAgent
+}
+
+// defaultFetcher backs the package-level functions, which have no Client to take a Fetcher from.
+var (
+	defaultFetcher       Fetcher = NewHTTPFetcher(FetcherConfig{})
+	defaultSourceFetcher Fetcher = retryingFetcher{fetcher: defaultFetcher, policy: DefaultRetryPolicy, timeout: DefaultFetchTimeout}
+)
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, u *url.URL) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error building HTTP request: %w", err)
+	}
+	for k, vs := range f.cfg.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("User-Agent", f.cfg.UserAgent)
+	resp, err := f.cfg.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error on HTTP request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		// The body is only a courtesy here, so a failed read just leaves it short.
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return nil, &HTTPStatusError{URL: u.String(), StatusCode: resp.StatusCode, Header: resp.Header, Body: body}
+	}
+	// Read one byte past the limit, so we can tell "exactly at the limit" from "over it".
+	bs, err := io.ReadAll(io.LimitReader(resp.Body, f.cfg.MaxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(bs)) > f.cfg.MaxBodyBytes {
+		return nil, fmt.Errorf("%w (%d bytes): %s", ErrBodyTooLarge, f.cfg.MaxBodyBytes, u)
+	}
+	return bs, nil
+}
+
+// ParseHeader turns "Key: Value" lines, as you'd pass to curl -H, into a Header for FetcherConfig.
+func ParseHeader(lines []string) (http.Header, error) {
+	h := http.Header{}
+	for _, l := range lines {
+		k, v, found := strings.Cut(l, ":")
+		if !found || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidHeader, l)
+		}
+		h.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	return h, nil
+}
@@ -0,0 +1,99 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHTTPFetcherFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.Header().Set("X-Request-Id", "abc")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("no such page"))
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("User-Agent") + "|" + r.Header.Get("Accept-Language")))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name        string
+		cfg         FetcherConfig
+		path        string
+		expected    string
+		expectedErr error
+	}{
+		{name: "defaults", expected: DefaultUserAgent + "|"},
+		{name: "custom headers", cfg: FetcherConfig{UserAgent: "my-bot/2.0", Header: http.Header{"Accept-Language": {"en-GB"}, "User-Agent": {"ignored"}}}, expected: "my-bot/2.0|en-GB"},
+		{name: "custom client", cfg: FetcherConfig{Client: srv.Client()}, expected: DefaultUserAgent + "|"},
+		{name: "max body", cfg: FetcherConfig{UserAgent: "abc", MaxBodyBytes: 3}, expectedErr: ErrBodyTooLarge},
+		{name: "exactly max body", cfg: FetcherConfig{UserAgent: "ab", MaxBodyBytes: 3}, expected: "ab|"},
+		{name: "non-200", path: "/missing", expectedErr: ErrNon200ResponseCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(srv.URL + tt.path)
+			bs, err := NewHTTPFetcher(tt.cfg).Fetch(context.Background(), u)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("expected err %v, got %v", tt.expectedErr, err)
+				}
+				var hse *HTTPStatusError
+				if errors.As(err, &hse) && (hse.StatusCode != http.StatusNotFound || string(hse.Body) != "no such page" ||
+					hse.Header.Get("X-Request-Id") != "abc" || hse.URL != u.String() || hse.Retryable()) {
+					t.Errorf("unexpected status error %+v", hse)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(bs) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, string(bs))
+			}
+		})
+	}
+}
+
+// mapFetcher serves canned bodies by URL, without any network.
+type mapFetcher map[string]string
+
+func (m mapFetcher) Fetch(_ context.Context, u *url.URL) ([]byte, error) {
+	body, ok := m[u.String()]
+	if !ok {
+		return nil, &HTTPStatusError{URL: u.String(), StatusCode: http.StatusNotFound}
+	}
+	return []byte(body), nil
+}
+
+func TestClientUsesFetcher(t *testing.T) {
+	f := mapFetcher{
+		"https://example.com/sitemap.xml": `<urlset><url><loc>https://example.com/a</loc></url></urlset>`,
+		"https://example.com/a":           `<html><body><p>from the fetcher</p></body></html>`,
+	}
+	fp := &fakeProvider{content: "ok"}
+	c := NewClient("", WithProvider(fp), WithFetcher(f))
+	urls, err := c.ParseSitemapURLs(context.Background(), "https://example.com/sitemap.xml")
+	if err != nil {
+		t.Fatalf("unexpected error parsing sitemap: %v", err)
+	}
+	if len(urls) != 1 || urls[0].String() != "https://example.com/a" {
+		t.Fatalf("unexpected urls %v", urls)
+	}
+	pr, err := c.NewPromptRequest(context.Background(), &PromptRequestInput{InputTag: "blog", OutputTag: "markdown", HTMLSelector: "p"})
+	if err != nil {
+		t.Fatalf("unexpected error building prompt request: %v", err)
+	}
+	if _, err := c.ExecPromptFor(context.Background(), pr, urls[0].String()); err != nil {
+		t.Fatalf("unexpected error executing prompt: %v", err)
+	}
+	if msg := fp.requests[0].Messages[1].Content; !strings.Contains(msg, "<p>from the fetcher</p>") {
+		t.Errorf("expected the fetched page in the prompt, got %q", msg)
+	}
+}
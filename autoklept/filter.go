@@ -0,0 +1,155 @@
+package autoklept
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// globPrefix marks a URL pattern as a glob rather than a regexp.
+const globPrefix = "glob:"
+
+var (
+	ErrInvalidURLPattern = errors.New("invalid URL pattern")
+	ErrInvalidDateWindow = errors.New("invalid date window, since must be before until")
+)
+
+// URLFilterConfig narrows down the URLs from sitemaps, feeds and crawls to the ones worth extracting.
+//
+// Patterns are regexps matched anywhere in the full URL, unless they start with "glob:". Globs are matched against
+// the whole URL path if they start with "/" (e.g. "glob:/blog/*"), else against the whole URL. In a glob, * matches
+// within one path segment, ** matches across them, and ? matches any one character but /. Path globs also match with
+// a trailing / on the path, so "glob:/blog/*" has both /blog/my-post and WordPress-style /blog/my-post/.
+type URLFilterConfig struct {
+	// Include, if set, keeps only URLs matching at least one of these.
+	Include []string
+	// Exclude drops URLs matching any of these, even if they're included.
+	Exclude []string
+	// Since and Until bound the lastmod (or feed date) window - Since is inclusive, Until exclusive, and zero is
+	// open-ended. While either is set, URLs with no date are dropped, since there's no telling which side they fall.
+	Since time.Time
+	Until time.Time
+}
+
+// URLFilter is a compiled URLFilterConfig. The zero value, or a nil one, keeps everything.
+type URLFilter struct {
+	include, exclude []urlPattern
+	since, until     time.Time
+}
+
+func NewURLFilter(cfg URLFilterConfig) (*URLFilter, error) {
+	include, err := compileURLPatterns(cfg.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileURLPatterns(cfg.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Since.IsZero() && !cfg.Until.IsZero() && !cfg.Since.Before(cfg.Until) {
+		return nil, fmt.Errorf("%w: %s / %s", ErrInvalidDateWindow, cfg.Since.Format(time.DateOnly), cfg.Until.Format(time.DateOnly))
+	}
+	return &URLFilter{include: include, exclude: exclude, since: cfg.Since, until: cfg.Until}, nil
+}
+
+// Keep reports whether `u`, last modified at `lastMod` (zero if unknown), gets through the filter.
+func (f *URLFilter) Keep(u *url.URL, lastMod time.Time) bool {
+	if f == nil {
+		return true
+	}
+	if !matchesAnyPattern(u, f.include, true) || matchesAnyPattern(u, f.exclude, false) {
+		return false
+	}
+	if f.since.IsZero() && f.until.IsZero() {
+		return true
+	}
+	if lastMod.IsZero() {
+		return false
+	}
+	return !lastMod.Before(f.since) && (f.until.IsZero() || lastMod.Before(f.until))
+}
+
+// FilterSitemapEntries is the entries `f` keeps, going by their <loc> and <lastmod>.
+func (f *URLFilter) FilterSitemapEntries(entries []SitemapEntry) []SitemapEntry {
+	var kept []SitemapEntry
+	for _, e := range entries {
+		if f.Keep(&e.Loc, e.LastMod) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// urlPattern is one compiled Include / Exclude pattern.
+type urlPattern struct {
+	re       *regexp.Regexp
+	pathOnly bool // Match against just the path, for globs starting with /.
+}
+
+func (p urlPattern) match(u *url.URL) bool {
+	if p.pathOnly {
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		return p.re.MatchString(path)
+	}
+	return p.re.MatchString(u.String())
+}
+
+func compileURLPatterns(patterns []string) ([]urlPattern, error) {
+	res := make([]urlPattern, 0, len(patterns))
+	for _, p := range patterns {
+		expr, pathOnly := p, false
+		if glob, ok := strings.CutPrefix(p, globPrefix); ok {
+			expr, pathOnly = globToRegexp(glob), strings.HasPrefix(glob, "/")
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w '%s': %w", ErrInvalidURLPattern, p, err)
+		}
+		res = append(res, urlPattern{re: re, pathOnly: pathOnly})
+	}
+	return res, nil
+}
+
+// globToRegexp translates a glob into an anchored regexp, quoting everything but the wildcards. A path glob not ending
+// in / lets one through anyway.
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			sb.WriteString("[^/]*")
+		case glob[i] == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	if strings.HasPrefix(glob, "/") && !strings.HasSuffix(glob, "/") {
+		sb.WriteString("/?")
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// matchesAnyPattern reports whether `u` matches any of `patterns`, or `ifNone` when there aren't any.
+func matchesAnyPattern(u *url.URL, patterns []urlPattern, ifNone bool) bool {
+	if len(patterns) == 0 {
+		return ifNone
+	}
+	for _, p := range patterns {
+		if p.match(u) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestURLFilterKeep(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse(time.DateOnly, s)
+		return d
+	}
+	tests := []struct {
+		name     string
+		cfg      URLFilterConfig
+		url      string
+		lastMod  time.Time
+		expected bool
+	}{
+		{name: "no rules", url: "https://example.com/", expected: true},
+		{name: "regexp include", cfg: URLFilterConfig{Include: []string{`/blog/\d{4}/`}}, url: "https://example.com/blog/2023/post", expected: true},
+		{name: "regexp include misses", cfg: URLFilterConfig{Include: []string{`/blog/\d{4}/`}}, url: "https://example.com/blog/post", expected: false},
+		{name: "glob path", cfg: URLFilterConfig{Include: []string{"glob:/blog/*"}}, url: "https://example.com/blog/post?ref=rss", expected: true},
+		{name: "glob trailing slash", cfg: URLFilterConfig{Include: []string{"glob:/blog/*"}}, url: "https://example.com/blog/my-post/", expected: true},
+		{name: "glob star stays in segment", cfg: URLFilterConfig{Include: []string{"glob:/blog/*"}}, url: "https://example.com/blog/2023/post", expected: false},
+		{name: "glob double star", cfg: URLFilterConfig{Include: []string{"glob:/blog/**"}}, url: "https://example.com/blog/2023/post", expected: true},
+		{name: "glob whole url", cfg: URLFilterConfig{Include: []string{"glob:https://*.example.com/**"}}, url: "https://www.example.com/a/b", expected: true},
+		{name: "glob is anchored", cfg: URLFilterConfig{Include: []string{"glob:/blog/*"}}, url: "https://example.com/en/blog/post", expected: false},
+		{name: "glob quotes regexp chars", cfg: URLFilterConfig{Include: []string{"glob:/a.b/?"}}, url: "https://example.com/axb/c", expected: false},
+		{name: "exclude wins", cfg: URLFilterConfig{Include: []string{"glob:/blog/**"}, Exclude: []string{"glob:/blog/tag/**"}}, url: "https://example.com/blog/tag/go", expected: false},
+		{name: "in window", cfg: URLFilterConfig{Since: day("2023-01-01"), Until: day("2024-01-01")}, url: "https://example.com/a", lastMod: day("2023-01-01"), expected: true},
+		{name: "until is exclusive", cfg: URLFilterConfig{Since: day("2023-01-01"), Until: day("2024-01-01")}, url: "https://example.com/a", lastMod: day("2024-01-01"), expected: false},
+		{name: "open ended", cfg: URLFilterConfig{Since: day("2023-01-01")}, url: "https://example.com/a", lastMod: day("2030-06-01"), expected: true},
+		{name: "before window", cfg: URLFilterConfig{Since: day("2023-01-01")}, url: "https://example.com/a", lastMod: day("2022-12-31"), expected: false},
+		{name: "undated in window", cfg: URLFilterConfig{Until: day("2024-01-01")}, url: "https://example.com/a", expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewURLFilter(tt.cfg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			u, _ := url.Parse(tt.url)
+			if actual := f.Keep(u, tt.lastMod); actual != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestNewURLFilterErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         URLFilterConfig
+		expectedErr error
+	}{
+		{name: "bad regexp", cfg: URLFilterConfig{Exclude: []string{`[`}}, expectedErr: ErrInvalidURLPattern},
+		{name: "backwards window", cfg: URLFilterConfig{Since: time.Now(), Until: time.Now().Add(-time.Hour)}, expectedErr: ErrInvalidDateWindow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewURLFilter(tt.cfg); !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected err %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestFilterSitemapEntries(t *testing.T) {
+	f, err := NewURLFilter(URLFilterConfig{Include: []string{"glob:/blog/*"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var entries []SitemapEntry
+	for _, s := range []string{"https://example.com/", "https://example.com/blog/a", "https://example.com/tags/go", "https://example.com/blog/b"} {
+		u, _ := url.Parse(s)
+		entries = append(entries, SitemapEntry{Loc: *u})
+	}
+	kept := f.FilterSitemapEntries(entries)
+	if len(kept) != 2 || kept[0].Loc.Path != "/blog/a" || kept[1].Loc.Path != "/blog/b" {
+		t.Errorf("unexpected entries kept %v", kept)
+	}
+}
+
+func TestBuildURLsFiltered(t *testing.T) {
+	f := mapFetcher{
+		"https://example.com/sitemap.xml": `<urlset>
+			<url><loc>https://example.com/</loc></url>
+			<url><loc>https://example.com/blog/old</loc><lastmod>2021-03-01</lastmod></url>
+			<url><loc>https://example.com/blog/new</loc><lastmod>2023-03-01</lastmod></url>
+			<url><loc>https://example.com/tags/go</loc><lastmod>2023-03-01</lastmod></url>
+		</urlset>`,
+	}
+	c := NewClient("", WithoutProvider(), WithFetcher(f))
+	tests := []struct {
+		name     string
+		cfg      *URLFilterConfig
+		expected []string
+	}{
+		{name: "no filter", expected: []string{"https://example.com/listed", "https://example.com/", "https://example.com/blog/old", "https://example.com/blog/new", "https://example.com/tags/go"}},
+		{name: "pattern and window", cfg: &URLFilterConfig{Include: []string{"glob:/blog/*"}, Since: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}, expected: []string{"https://example.com/listed", "https://example.com/blog/new"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filter *URLFilter
+			if tt.cfg != nil {
+				var err error
+				if filter, err = NewURLFilter(*tt.cfg); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			urls, err := c.BuildURLs(context.Background(), []string{"https://example.com/listed"}, []string{"https://example.com/sitemap.xml"}, filter)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var actual []string
+			for _, u := range urls {
+				actual = append(actual, u.String())
+			}
+			if !slices.Equal(actual, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
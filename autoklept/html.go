@@ -1,11 +1,40 @@
+//go:generate stringer -type=FallbackPolicy -linecomment -output fallback_policy_string.go
 package autoklept
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
+
 	"golang.org/x/net/html"
 )
 
+var (
+	ErrContentNodeNotFound = errors.New("no content node matched")
+)
+
+// matchSeparator goes between each node's HTML when every match is collected, so the LLM can tell where one ends.
+const matchSeparator = "\n<hr/>\n"
+
+// FallbackPolicy is what to do when neither the finder nor any of its fallbacks match anything,
+// which is usually a sign the site changed its templates.
+type FallbackPolicy int
+
+const (
+	// FallbackFail returns ErrContentNodeNotFound.
+	FallbackFail FallbackPolicy = iota // Fail
+	// FallbackDocument gives up on narrowing and uses the whole page.
+	FallbackDocument // Document
+)
+
+// NodeFinder locates the subtree of a page worth sending to the LLM, so we don't pay to parse the nav bar.
+// Both ElementNodeFinder and Selector are NodeFinders.
+type NodeFinder interface {
+	FindNode(doc *html.Node) *html.Node
+}
+
 // ElementNodeFinder lets the user specify a particular tag to start parsing from, instead of just parsing the whole input.
 // Example: <div id="123abc">
 type ElementNodeFinder struct {
@@ -14,30 +43,155 @@ type ElementNodeFinder struct {
 	AttrVal string
 }
 
-func parseHtmlByTag(htmlBody []byte, lookup *ElementNodeFinder) (*bytes.Buffer, error) {
+// NodeMatcher decides whether a single node matches, e.g. so that every matching node can be stripped out.
+// Both ElementNodeFinder and Selector are NodeMatchers.
+type NodeMatcher interface {
+	Match(n *html.Node) bool
+}
+
+func (f ElementNodeFinder) String() string {
+	return fmt.Sprintf("%s[%s=%q]", f.Tag, f.AttrKey, f.AttrVal)
+}
+
+func (f ElementNodeFinder) FindNode(doc *html.Node) *html.Node {
+	return findElementNode(doc, f)
+}
+
+func (f ElementNodeFinder) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode || n.Data != f.Tag {
+		return false
+	}
+	for _, attr := range n.Attr {
+		if attr.Key == f.AttrKey && attr.Val == f.AttrVal {
+			return true
+		}
+	}
+	return false
+}
+
+// htmlParseOpts is everything parseHtmlByTag needs to turn a fetched page into the HTML we actually prompt with.
+type htmlParseOpts struct {
+	finder     NodeFinder
+	fallbacks  []NodeFinder // Tried in order if finder matches nothing.
+	onNotFound FallbackPolicy
+	matchAll   bool // Collect every match in document order, rather than just the first.
+	excludes   []NodeMatcher
+	clean      CleanLevel
+	base       *url.URL // Relative links are resolved against this, if set. It's per page, unlike the rest.
+}
+
+// parseHtmlByTag narrows the page down to what the finder finds, strips anything matching the excludes out of that,
+// and then cleans what's left. With none of those configured, and no base URL to resolve links against, the page is
+// passed through untouched.
+// It also returns how big the HTML was before cleaning, to show what cleaning saved.
+func parseHtmlByTag(htmlBody []byte, opts htmlParseOpts) (*bytes.Buffer, int, error) {
+	buf := bytes.Buffer{}
+	if opts.finder == nil && len(opts.excludes) == 0 && opts.clean == CleanNone && opts.base == nil {
+		buf.Write(htmlBody)
+		return &buf, buf.Len(), nil
+	}
 	doc, err := html.Parse(bytes.NewReader(htmlBody))
 	if err != nil {
-		return nil, fmt.Errorf("error parsing html: %w", err)
+		return nil, 0, fmt.Errorf("error parsing html: %w", err)
 	}
-	buf := bytes.Buffer{}
-	if lookup != nil {
-		content := findElementNode(doc, *lookup)
+	contents, err := findContentNodes(doc, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	base := documentBase(doc, opts.base)
+	uncleaned := 0
+	for i, content := range contents {
+		removeMatching(content, opts.excludes)
+		resolveLinks(content, base)
+		if i > 0 {
+			buf.WriteString(matchSeparator)
+			uncleaned += len(matchSeparator)
+		}
+		if opts.clean != CleanNone {
+			var raw bytes.Buffer
+			if err = html.Render(&raw, content); err != nil {
+				return nil, 0, fmt.Errorf("error rendering html: %w", err)
+			}
+			uncleaned += raw.Len()
+		}
+		cleanHTML(content, opts.clean)
 		if err = html.Render(&buf, content); err != nil {
-			return nil, fmt.Errorf("error rendering html: %w", err)
+			return nil, 0, fmt.Errorf("error rendering html: %w", err)
 		}
-	} else {
-		buf.Write(htmlBody)
 	}
-	return &buf, nil
+	if opts.clean == CleanNone {
+		uncleaned = buf.Len()
+	}
+	return &buf, uncleaned, nil
 }
 
-func findElementNode(n *html.Node, lookup ElementNodeFinder) *html.Node {
-	if n.Type == html.ElementNode && n.Data == lookup.Tag {
-		for _, attr := range n.Attr {
-			if attr.Key == lookup.AttrKey && attr.Val == lookup.AttrVal {
-				return n
-			}
+// findContentNodes runs the finder, then each fallback in turn, and then falls back to the policy.
+func findContentNodes(doc *html.Node, opts htmlParseOpts) ([]*html.Node, error) {
+	if opts.finder == nil {
+		return []*html.Node{doc}, nil
+	}
+	for _, f := range append([]NodeFinder{opts.finder}, opts.fallbacks...) {
+		if found := findWith(doc, f, opts.matchAll); len(found) > 0 {
+			return found, nil
+		}
+	}
+	if opts.onNotFound == FallbackDocument {
+		return []*html.Node{doc}, nil
+	}
+	return nil, fmt.Errorf("%w: %v", ErrContentNodeNotFound, opts.finder)
+}
+
+// findWith collects every match if asked to and the finder can match node by node, and just the first otherwise.
+func findWith(doc *html.Node, f NodeFinder, all bool) []*html.Node {
+	if m, ok := f.(NodeMatcher); ok && all {
+		return findAllMatching(doc, m, nil)
+	}
+	if found := f.FindNode(doc); found != nil {
+		return []*html.Node{found}
+	}
+	return nil
+}
+
+// findAllMatching returns matches in document order. A match's descendants aren't searched, since they're already
+// included in it - otherwise nested matches would send the same content twice.
+func findAllMatching(n *html.Node, m NodeMatcher, found []*html.Node) []*html.Node {
+	if m.Match(n) {
+		return append(found, n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		found = findAllMatching(c, m, found)
+	}
+	return found
+}
+
+// removeMatching detaches every descendant of `n` matching any of `excludes`. `n` itself is never removed.
+func removeMatching(n *html.Node, excludes []NodeMatcher) {
+	if len(excludes) == 0 {
+		return
+	}
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if matchesAny(c, excludes) {
+			n.RemoveChild(c)
+		} else {
+			removeMatching(c, excludes)
 		}
+		c = next
+	}
+}
+
+func matchesAny(n *html.Node, matchers []NodeMatcher) bool {
+	for _, m := range matchers {
+		if m.Match(n) {
+			return true
+		}
+	}
+	return false
+}
+
+func findElementNode(n *html.Node, lookup ElementNodeFinder) *html.Node {
+	if lookup.Match(n) {
+		return n
 	}
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
 		if found := findElementNode(c, lookup); found != nil {
@@ -46,3 +200,42 @@ func findElementNode(n *html.Node, lookup ElementNodeFinder) *html.Node {
 	}
 	return nil
 }
+
+var (
+	// linkAttrs are the attributes holding URLs worth making absolute, so links survive being lifted out of the page.
+	linkAttrs    = map[string]bool{"href": true, "src": true}
+	baseSelector = MustParseSelector("base[href]")
+)
+
+// documentBase is `base`, unless the page has its own <base href> to say otherwise.
+func documentBase(doc *html.Node, base *url.URL) *url.URL {
+	if base == nil {
+		return nil
+	}
+	if n := baseSelector.FindNode(doc); n != nil {
+		if href, err := url.Parse(getAttr(n, "href")); err == nil {
+			return base.ResolveReference(href)
+		}
+	}
+	return base
+}
+
+// resolveLinks rewrites relative links under `n` against `base`. Anything we can't parse is left alone.
+func resolveLinks(n *html.Node, base *url.URL) {
+	if base == nil {
+		return
+	}
+	if n.Type == html.ElementNode {
+		for i, a := range n.Attr {
+			if !linkAttrs[a.Key] {
+				continue
+			}
+			if ref, err := url.Parse(strings.TrimSpace(a.Val)); err == nil {
+				n.Attr[i].Val = base.ResolveReference(ref).String()
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		resolveLinks(c, base)
+	}
+}
@@ -0,0 +1,118 @@
+package autoklept
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseHtmlByTagExcludes(t *testing.T) {
+	page := []byte(`<html><body><nav>menu</nav><article class="post">
+<p>keep me</p>
+<div class="share"><a href="#">tweet</a></div>
+<section id="comments"><p>first!</p></section>
+<p>keep me too</p><form class="newsletter">sign up</form>
+</article></body></html>`)
+	excludes := []NodeMatcher{
+		MustParseSelector(".share"),
+		MustParseSelector("#comments"),
+		ElementNodeFinder{Tag: "form", AttrKey: "class", AttrVal: "newsletter"},
+	}
+	tests := []struct {
+		name      string
+		lookup    NodeFinder
+		excludes  []NodeMatcher
+		contains  []string
+		excluding []string
+	}{
+		{name: "finder only", lookup: MustParseSelector("article"), contains: []string{"keep me", "tweet", "first!"}, excluding: []string{"menu"}},
+		{name: "finder and excludes", lookup: MustParseSelector("article"), excludes: excludes, contains: []string{"keep me", "keep me too"}, excluding: []string{"menu", "tweet", "first!", "sign up"}},
+		{name: "excludes only", excludes: excludes, contains: []string{"menu", "keep me"}, excluding: []string{"tweet", "first!", "sign up"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, _, err := parseHtmlByTag(page, htmlParseOpts{finder: tt.lookup, excludes: tt.excludes})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out := buf.String()
+			for _, c := range tt.contains {
+				if !strings.Contains(out, c) {
+					t.Errorf("expected output to contain %q, got %q", c, out)
+				}
+			}
+			for _, e := range tt.excluding {
+				if strings.Contains(out, e) {
+					t.Errorf("expected output not to contain %q, got %q", e, out)
+				}
+			}
+		})
+	}
+}
+
+func TestParseHtmlByTagNotFound(t *testing.T) {
+	page := []byte(`<html><body><main class="new-template"><p>content</p></main></body></html>`)
+	finder := ElementNodeFinder{Tag: "div", AttrKey: "id", AttrVal: "old-template"}
+	tests := []struct {
+		name        string
+		opts        htmlParseOpts
+		expected    string
+		expectedErr error
+	}{
+		{name: "fail", opts: htmlParseOpts{finder: finder}, expectedErr: ErrContentNodeNotFound},
+		{name: "fallback selector", opts: htmlParseOpts{finder: finder, fallbacks: []NodeFinder{MustParseSelector("article"), MustParseSelector("main")}}, expected: `<main class="new-template"><p>content</p></main>`},
+		{name: "document", opts: htmlParseOpts{finder: finder, onNotFound: FallbackDocument}, expected: `<html><head></head><body><main class="new-template"><p>content</p></main></body></html>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, _, err := parseHtmlByTag(page, tt.opts)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("expected err %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestParseHtmlByTagMatchAll(t *testing.T) {
+	page := []byte(`<html><body><div class="post"><p>one</p></div><aside>ad</aside><div class="post"><p>two</p><div class="post"><p>nested</p></div></div></body></html>`)
+	tests := []struct {
+		name     string
+		finder   NodeFinder
+		matchAll bool
+		expected string
+	}{
+		{name: "first only", finder: MustParseSelector(".post"), expected: `<div class="post"><p>one</p></div>`},
+		{
+			name:     "selector",
+			finder:   MustParseSelector(".post"),
+			matchAll: true,
+			expected: `<div class="post"><p>one</p></div>` + matchSeparator + `<div class="post"><p>two</p><div class="post"><p>nested</p></div></div>`,
+		},
+		{
+			name:     "element node finder",
+			finder:   ElementNodeFinder{Tag: "div", AttrKey: "class", AttrVal: "post"},
+			matchAll: true,
+			expected: `<div class="post"><p>one</p></div>` + matchSeparator + `<div class="post"><p>two</p><div class="post"><p>nested</p></div></div>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, _, err := parseHtmlByTag(page, htmlParseOpts{finder: tt.finder, matchAll: tt.matchAll})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
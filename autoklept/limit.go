@@ -0,0 +1,124 @@
+package autoklept
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// HostRateLimit is how politely we fetch from any one host. Zero fields are unlimited.
+type HostRateLimit struct {
+	RequestsPerSecond float64
+	// MaxConcurrent caps requests in flight to the host at once.
+	MaxConcurrent int
+	// CrawlDelay is the least time between the start of one request to the host and the next.
+	// It's applied on top of RequestsPerSecond - whichever is slower wins.
+	CrawlDelay time.Duration
+}
+
+// ChatRateLimit throttles LLM calls, independent of any fetching. Zero fields are unlimited.
+type ChatRateLimit struct {
+	RequestsPerSecond float64
+	MaxConcurrent     int
+}
+
+// limiter spaces out requests by a minimum interval, and caps how many run at once.
+type limiter struct {
+	slots chan struct{} // Nil if concurrency isn't capped.
+	mu    sync.Mutex
+	every time.Duration
+	next  time.Time // The earliest the next request may start.
+}
+
+func newLimiter(rps float64, maxConcurrent int, minInterval time.Duration) *limiter {
+	l := &limiter{every: minInterval}
+	if rps > 0 {
+		l.every = max(l.every, time.Duration(float64(time.Second)/rps))
+	}
+	if maxConcurrent > 0 {
+		l.slots = make(chan struct{}, maxConcurrent)
+	}
+	return l
+}
+
+// wait blocks until a request may start, and returns the func to call once it's done.
+// Nobody holds a place in the schedule while they wait, so a waiter giving up doesn't push back everyone after it.
+func (l *limiter) wait(ctx context.Context) (func(), error) {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if !now.Before(l.next) {
+			l.next = now.Add(l.every)
+			l.mu.Unlock()
+			return release, nil
+		}
+		d := l.next.Sub(now)
+		l.mu.Unlock()
+		// Whoever else was waiting for the same moment may beat us to it, in which case we go round again.
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			release()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// setMinInterval slows the limiter down to at least `d` between requests, e.g. for a robots.txt Crawl-delay.
+func (l *limiter) setMinInterval(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.every = max(l.every, d)
+}
+
+// hostLimiter keeps a limiter per host, all built from the same HostRateLimit.
+type hostLimiter struct {
+	limit HostRateLimit
+	mu    sync.Mutex
+	hosts map[string]*limiter
+}
+
+func newHostLimiter(limit HostRateLimit) *hostLimiter {
+	return &hostLimiter{limit: limit, hosts: map[string]*limiter{}}
+}
+
+func (h *hostLimiter) forHost(host string) *limiter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l, ok := h.hosts[host]
+	if !ok {
+		l = newLimiter(h.limit.RequestsPerSecond, h.limit.MaxConcurrent, h.limit.CrawlDelay)
+		h.hosts[host] = l
+	}
+	return l
+}
+
+// fetchAttempt is one go at fetching `u`: wait for the host's turn, then fetch within `timeout`. Time spent queueing
+// doesn't count against the timeout, since nothing's been sent yet. Nil `hosts` means no limits.
+func fetchAttempt(ctx context.Context, f Fetcher, hosts *hostLimiter, timeout time.Duration, u *url.URL) ([]byte, error) {
+	if hosts != nil {
+		done, err := hosts.forHost(u.Host).wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer done()
+	}
+	return withDeadline(ctx, timeout, ErrFetchTimeout, func(ctx context.Context) ([]byte, error) {
+		return f.Fetch(ctx, u)
+	})
+}
@@ -0,0 +1,141 @@
+package autoklept
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingFetcher tracks the most Fetches it's seen in flight at once.
+type countingFetcher struct {
+	inFlight, peak atomic.Int32
+}
+
+func (f *countingFetcher) Fetch(_ context.Context, _ *url.URL) ([]byte, error) {
+	n := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	for {
+		p := f.peak.Load()
+		if n <= p || f.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return nil, nil
+}
+
+func TestFetchAttemptLimits(t *testing.T) {
+	tests := []struct {
+		name         string
+		limit        HostRateLimit
+		urls         []string
+		expectedPeak int32
+		minElapsed   time.Duration
+	}{
+		{name: "unlimited", urls: []string{"http://a/1", "http://a/2", "http://a/3", "http://a/4"}, expectedPeak: 4},
+		{name: "max concurrent", limit: HostRateLimit{MaxConcurrent: 2}, urls: []string{"http://a/1", "http://a/2", "http://a/3", "http://a/4"}, expectedPeak: 2},
+		{name: "per host", limit: HostRateLimit{MaxConcurrent: 1}, urls: []string{"http://a/1", "http://b/1", "http://c/1"}, expectedPeak: 3},
+		{name: "requests per second", limit: HostRateLimit{RequestsPerSecond: 50}, urls: []string{"http://a/1", "http://a/2", "http://a/3", "http://a/4"}, minElapsed: 60 * time.Millisecond},
+		{name: "crawl delay", limit: HostRateLimit{RequestsPerSecond: 1000, CrawlDelay: 30 * time.Millisecond}, urls: []string{"http://a/1", "http://a/2", "http://a/3"}, minElapsed: 60 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cf := &countingFetcher{}
+			hosts := newHostLimiter(tt.limit)
+			start := time.Now()
+			var wg sync.WaitGroup
+			for _, raw := range tt.urls {
+				u, _ := url.Parse(raw)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := fetchAttempt(context.Background(), cf, hosts, 0, u); err != nil {
+						t.Errorf("unexpected error: %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+			if tt.expectedPeak > 0 && cf.peak.Load() != tt.expectedPeak {
+				t.Errorf("expected peak concurrency %d, got %d", tt.expectedPeak, cf.peak.Load())
+			}
+			if elapsed := time.Since(start); elapsed < tt.minElapsed {
+				t.Errorf("expected requests spread over at least %v, took %v", tt.minElapsed, elapsed)
+			}
+		})
+	}
+}
+
+func TestLimiterWaitCancelled(t *testing.T) {
+	l := newLimiter(0, 1, 0)
+	done, err := l.wait(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.wait(ctx); err == nil {
+		t.Errorf("expected waiting on a full limiter to give up with the context")
+	}
+	done()
+	if _, err := l.wait(context.Background()); err != nil {
+		t.Errorf("expected the released slot to be free, got %v", err)
+	}
+}
+
+func TestLimiterWaitCancelledKeepsSchedule(t *testing.T) {
+	l := newLimiter(0, 0, 50*time.Millisecond)
+	start := time.Now()
+	if _, err := l.wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Waiters giving up shouldn't leave their turns behind for everyone else to wait out.
+	for range 3 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		if _, err := l.wait(ctx); err == nil {
+			t.Errorf("expected waiting out the interval to give up with the context")
+		}
+		cancel()
+	}
+	if _, err := l.wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 90*time.Millisecond {
+		t.Errorf("expected the next request 50ms after the first, got %v", elapsed)
+	}
+}
+
+func TestExecPromptForQueueLongerThanFetchTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html><body><p>hello</p></body></html>`))
+	}))
+	defer srv.Close()
+	// Five pages 40ms apart queue for 160ms, well past the 60ms fetch timeout - which should only count once we fetch.
+	c := NewClient("", WithProvider(&fakeProvider{content: "ok"}), WithRobotsTxt(false), WithFetchTimeout(60*time.Millisecond),
+		WithHostRateLimit(HostRateLimit{CrawlDelay: 40 * time.Millisecond}))
+	pr, err := c.NewPromptRequest(context.Background(), &PromptRequestInput{InputTag: "blog", OutputTag: "markdown"})
+	if err != nil {
+		t.Fatalf("unexpected error building prompt request: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.ExecPromptFor(context.Background(), pr, fmt.Sprintf("%s/%d", srv.URL, i))
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if resp.FetchAttempts != 1 {
+				t.Errorf("expected 1 fetch attempt, got %d", resp.FetchAttempts)
+			}
+		}()
+	}
+	wg.Wait()
+}
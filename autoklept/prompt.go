@@ -1,36 +1,92 @@
 package autoklept
 
 import (
-	"bytes"
-	"github.com/cohesion-org/deepseek-go"
-	"github.com/cohesion-org/deepseek-go/constants"
+	"slices"
+	"strings"
 )
 
 type PromptResponse struct {
 	Content          string
 	ReasoningContent string
 	TokensUsed       int
+	// PageBytes is the size of the page as fetched (or given).
+	PageBytes int
+	// HTMLBytesBefore and HTMLBytesAfter are the size of what's left of the page after finding and excluding, before
+	// and after cleaning. HTMLBytesAfter is what was actually sent to the LLM.
+	HTMLBytesBefore int
+	HTMLBytesAfter  int
+	// Chunks is how many requests the page was split across to fit the model's context. 1 means it wasn't split.
+	Chunks int
+	// FinishReason is why the model stopped on the last request, e.g. FinishReasonStop.
+	FinishReason string
+	// Continuations is how many extra requests it took to get output that hit the model's token limit finished.
+	Continuations int
+	// Partial means some of the output was still truncated after MaxContinuations, so Content is incomplete.
+	Partial bool
+	// FetchAttempts and ChatAttempts count every try, retries included. FetchAttempts is 0 for caller-supplied HTML.
+	FetchAttempts int
+	ChatAttempts  int
 }
 
-func newPromptResponse(ccr *deepseek.ChatCompletionResponse) *PromptResponse {
-	return &PromptResponse{
-		Content:          ccr.Choices[0].Message.Content,
-		ReasoningContent: ccr.Choices[0].Message.ReasoningContent,
-		TokensUsed:       ccr.Usage.TotalTokens,
+// addChunk stitches one chunk's output onto the response. Hugo front matter is only kept from the first chunk.
+func (prsp *PromptResponse) addChunk(cr *ChatResponse, output PromptOutputTag) {
+	content := cr.Content
+	if prsp.Chunks > 0 {
+		if output == PromptOutputHugo {
+			content = stripFrontMatter(content)
+		}
+		content = strings.TrimRight(prsp.Content, "\n") + chunkSeparator + content
 	}
+	prsp.Content = content
+	if prsp.ReasoningContent != "" && cr.ReasoningContent != "" {
+		prsp.ReasoningContent += chunkSeparator
+	}
+	prsp.ReasoningContent += cr.ReasoningContent
+	prsp.TokensUsed += cr.TokensUsed
+	prsp.FinishReason = cr.FinishReason
+	prsp.Partial = prsp.Partial || cr.FinishReason == FinishReasonLength
+	prsp.Chunks++
 }
 
 type PromptRequestInput struct {
 	InputTag   string
 	OutputTag  string
 	HTMLFinder *ElementNodeFinder
+	// HTMLSelector is a CSS selector for the content subtree, e.g. "article.post > div.entry-content".
+	// It's the more expressive alternative to HTMLFinder; set one or the other.
+	HTMLSelector string
+	// HTMLExclude are CSS selectors for boilerplate (share buttons, comments, newsletter forms...) to strip out of
+	// the content before prompting, so the LLM can't copy it into the output and we don't pay for it.
+	HTMLExclude []string
+	// CleanLevel is a CleanLevel name (None, Light or Aggressive). Empty means None.
+	CleanLevel string
+	// HTMLFallbackSelectors are CSS selectors tried in order when HTMLFinder / HTMLSelector matches nothing.
+	HTMLFallbackSelectors []string
+	// OnNotFound is a FallbackPolicy name (Fail or Document), applied when nothing matches at all. Empty means Fail.
+	OnNotFound string
+	// HTMLMatchAll sends every node the finder matches, in document order, instead of only the first.
+	// Useful for multi-section articles and forum threads spread over many same-class siblings.
+	HTMLMatchAll bool
+	// MaxInputTokens caps the estimated size of each request. Pages over it are split on block boundaries and
+	// extracted chunk by chunk, then stitched back together. Continuations stop short of going over it too, leaving
+	// the output Partial. 0 means never split.
+	MaxInputTokens int
+	// MaxContinuations caps how many times we ask the model to carry on when its output hits the token limit.
+	// 0 means DefaultMaxContinuations, and a negative number never continues.
+	MaxContinuations int
 }
 
+// PromptRequest is everything about an extraction except the page itself. It's never modified after
+// NewPromptRequest, so build one and share it between as many concurrent ExecPromptFor calls as you like.
 type PromptRequest struct {
 	systemRole string
 	prompt     string
-	nodeFinder *ElementNodeFinder
-	ccr        deepseek.ChatCompletionRequest
+	output     PromptOutputTag
+	htmlOpts   htmlParseOpts
+	chat       ChatRequest // The template every request starts from, without any page HTML.
+	// maxInputTokens is PromptRequestInput.MaxInputTokens.
+	maxInputTokens   int
+	maxContinuations int
 }
 
 func (pr *PromptRequest) SystemRole() string {
@@ -41,10 +97,38 @@ func (pr *PromptRequest) Prompt() string {
 	return pr.prompt
 }
 
-func (pr *PromptRequest) setPromptWithBytes(bs *bytes.Buffer) {
-	p := pr.prompt + "\n" + bs.String()
-	pm := deepseek.ChatCompletionMessage{Role: constants.ChatMessageRoleUser, Content: p}
-	pr.ccr.Messages = append(pr.ccr.Messages, pm)
+// chatRequestFor builds the request for one page (or chunk of one), leaving the template in `pr.chat` untouched.
+func (pr *PromptRequest) chatRequestFor(body string) *ChatRequest {
+	p := pr.prompt + "\n" + body
+	pm := ChatMessage{Role: ChatRoleUser, Content: p}
+	return &ChatRequest{Messages: append(slices.Clone(pr.chat.Messages), pm)}
+}
+
+// continuationFor asks the model to pick up after `soFar`, which was cut off by the output token limit.
+func continuationFor(req *ChatRequest, soFar string) *ChatRequest {
+	msgs := append(slices.Clone(req.Messages),
+		ChatMessage{Role: ChatRoleAssistant, Content: soFar},
+		ChatMessage{Role: ChatRoleUser, Content: continuePrompt},
+	)
+	return &ChatRequest{Messages: msgs}
+}
+
+// estimateTokens is EstimateTokens over every message in the request.
+func (r *ChatRequest) estimateTokens() int {
+	n := 0
+	for _, m := range r.Messages {
+		n += EstimateTokens(m.Content)
+	}
+	return n
+}
+
+// htmlBudget is how many estimated tokens of HTML fit in each request, once the prompt itself is paid for.
+func (pr *PromptRequest) htmlBudget() (int, error) {
+	budget := pr.maxInputTokens - EstimateTokens(pr.systemRole) - EstimateTokens(pr.prompt)
+	if budget <= 0 {
+		return 0, ErrMaxInputTokensTooSmall
+	}
+	return budget, nil
 }
 
 func buildPromptString(input PromptInputTag, output PromptOutputTag) string {
@@ -14,6 +14,8 @@ const (
 		"- When you output, do not write anything before or after the raw output you formatted from the original content. DO NOT output any backtick open / close blocks, like ```markdown\n<content here...>\n``` or ```toml\n<content here...>\n```."
 
 	deepseekStdPrompt = "Extract out all actual user content from the following HTML. "
+	// continuePrompt asks for the rest of an extraction that hit the output token limit.
+	continuePrompt = "Your output was cut off. Continue exactly where you stopped, without repeating anything or adding any commentary."
 )
 
 var (
@@ -0,0 +1,51 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrNoProvider = errors.New("client has no LLM provider")
+)
+
+// Provider is any LLM backend that can answer a chat completion request.
+// autoklept owns the request / response types so that no backend's types leak out of the library.
+type Provider interface {
+	CreateChatCompletion(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
+}
+
+const (
+	ChatRoleSystem    = "system"
+	ChatRoleUser      = "user"
+	ChatRoleAssistant = "assistant"
+)
+
+// FinishReasons as reported by OpenAI-compatible APIs and Ollama. Anything else is passed through as-is.
+const (
+	FinishReasonStop   = "stop"
+	FinishReasonLength = "length" // The model hit its output token limit, so the content is truncated.
+)
+
+type ChatMessage struct {
+	Role    string
+	Content string
+}
+
+type ChatRequest struct {
+	Messages []ChatMessage
+}
+
+type ChatResponse struct {
+	Content          string
+	ReasoningContent string
+	TokensUsed       int
+	FinishReason     string
+}
+
+// noProvider is what WithoutProvider leaves a Client with.
+type noProvider struct{}
+
+func (noProvider) CreateChatCompletion(context.Context, *ChatRequest) (*ChatResponse, error) {
+	return nil, ErrNoProvider
+}
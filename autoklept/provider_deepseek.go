@@ -0,0 +1,102 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cohesion-org/deepseek-go"
+)
+
+const (
+	deepseekBaseURL = "https://api.deepseek.com/"
+	// deepseekNoTimeout is long enough that deepseek-go's own deadline never beats ours (see Config.DeepseekTimeout).
+	// Left at zero, deepseek-go would use DEEPSEEK_TIMEOUT, or 5 minutes.
+	deepseekNoTimeout = 100 * 365 * 24 * time.Hour
+)
+
+var (
+	ErrEmptyChatResponse = errors.New("chat completion returned no choices")
+)
+
+// DeepseekProvider is the default Provider, backed by the DeepSeek API.
+type DeepseekProvider struct {
+	client *deepseek.Client
+	model  string
+}
+
+// NewDeepseekProvider falls back on DEEPSEEK_API_KEY, like deepseek-go does. A missing key only fails once we chat.
+func NewDeepseekProvider(apiKey string) *DeepseekProvider {
+	if apiKey == "" {
+		apiKey = os.Getenv("DEEPSEEK_API_KEY")
+	}
+	return &DeepseekProvider{
+		// Built directly rather than via deepseek.NewClient, which prints to stdout (and returns nil) without a key.
+		client: newDeepseekClient(apiKey, deepseekBaseURL),
+		// This actually perform better than the deepseek-reasoner at clean extraction. Hilarious.
+		model: deepseek.DeepSeekChat,
+	}
+}
+
+func (p *DeepseekProvider) CreateChatCompletion(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	return createChatCompletion(ctx, p.client, p.model, req)
+}
+
+// newDeepseekClient is a deepseek-go client whose only deadline is the one we give it.
+func newDeepseekClient(apiKey, baseURL string) *deepseek.Client {
+	return &deepseek.Client{
+		AuthToken:  apiKey,
+		BaseURL:    baseURL,
+		Path:       "chat/completions",
+		Timeout:    deepseekNoTimeout,
+		HTTPClient: retryAfterDoer{},
+	}
+}
+
+// retryAfterKey carries a *string through a request's context, for retryAfterDoer to fill in.
+type retryAfterKey struct{}
+
+// retryAfterDoer notes the Retry-After header on an error response, since deepseek.APIError doesn't keep headers.
+type retryAfterDoer struct{}
+
+func (retryAfterDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil && resp.StatusCode >= http.StatusBadRequest {
+		if ra, ok := req.Context().Value(retryAfterKey{}).(*string); ok {
+			*ra = resp.Header.Get("Retry-After")
+		}
+	}
+	return resp, err
+}
+
+// createChatCompletion speaks the OpenAI chat-completions protocol via deepseek-go, which is all DeepSeek really is.
+func createChatCompletion(ctx context.Context, client *deepseek.Client, model string, req *ChatRequest) (*ChatResponse, error) {
+	ccr := &deepseek.ChatCompletionRequest{Model: model}
+	for _, m := range req.Messages {
+		ccr.Messages = append(ccr.Messages, deepseek.ChatCompletionMessage{Role: m.Role, Content: m.Content})
+	}
+	var ra string
+	resp, err := client.CreateChatCompletion(context.WithValue(ctx, retryAfterKey{}, &ra), ccr)
+	if err != nil {
+		if ra != "" {
+			return nil, &retryAfterError{err: err, retryAfter: ra}
+		}
+		return nil, err
+	}
+	return newChatResponse(resp)
+}
+
+// newChatResponse translates a deepseek-go response, which is also the shape of any OpenAI-compatible response.
+func newChatResponse(ccr *deepseek.ChatCompletionResponse) (*ChatResponse, error) {
+	if len(ccr.Choices) == 0 {
+		return nil, ErrEmptyChatResponse
+	}
+	return &ChatResponse{
+		Content:          ccr.Choices[0].Message.Content,
+		ReasoningContent: ccr.Choices[0].Message.ReasoningContent,
+		TokensUsed:       ccr.Usage.TotalTokens,
+		FinishReason:     ccr.Choices[0].FinishReason,
+	}, nil
+}
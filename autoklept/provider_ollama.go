@@ -0,0 +1,74 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ollama/ollama/api"
+)
+
+const (
+	DefaultOllamaHost = "http://localhost:11434"
+)
+
+var (
+	ErrOllamaModelRequired = errors.New("an Ollama model name is required")
+)
+
+// OllamaConfig points autoklept at a local (or at least self-hosted) Ollama server, so content never leaves your network.
+type OllamaConfig struct {
+	Host  string // Defaults to DefaultOllamaHost.
+	Model string // Must already be pulled on the Ollama host, e.g. "llama3.1:8b".
+	// ContextLength overrides the model's default context window (num_ctx). Ollama's default is small for whole blog posts.
+	ContextLength int
+}
+
+// OllamaProvider is a Provider backed by Ollama's native chat API.
+type OllamaProvider struct {
+	client *api.Client
+	cfg    OllamaConfig
+}
+
+func NewOllamaProvider(cfg OllamaConfig) (*OllamaProvider, error) {
+	if cfg.Model == "" {
+		return nil, ErrOllamaModelRequired
+	}
+	if cfg.Host == "" {
+		cfg.Host = DefaultOllamaHost
+	}
+	u, err := url.Parse(cfg.Host)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Ollama host: %w", err)
+	}
+	return &OllamaProvider{client: api.NewClient(u, http.DefaultClient), cfg: cfg}, nil
+}
+
+func (p *OllamaProvider) CreateChatCompletion(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	stream := false
+	or := &api.ChatRequest{Model: p.cfg.Model, Stream: &stream}
+	for _, m := range req.Messages {
+		or.Messages = append(or.Messages, api.Message{Role: m.Role, Content: m.Content})
+	}
+	if p.cfg.ContextLength > 0 {
+		or.Options = map[string]any{"num_ctx": p.cfg.ContextLength}
+	}
+	var last *api.ChatResponse
+	err := p.client.Chat(ctx, or, func(resp api.ChatResponse) error {
+		last = &resp
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return nil, ErrEmptyChatResponse
+	}
+	return &ChatResponse{
+		Content:      last.Message.Content,
+		TokensUsed:   last.PromptEvalCount + last.EvalCount,
+		FinishReason: last.DoneReason,
+	}, nil
+}
@@ -0,0 +1,60 @@
+package autoklept
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOllamaProvider(t *testing.T) {
+	var got struct {
+		Model    string         `json:"model"`
+		Stream   bool           `json:"stream"`
+		Options  map[string]any `json:"options"`
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"model":"tiny","message":{"role":"assistant","content":"# Hello"},"done":true,"done_reason":"stop","prompt_eval_count":10,"eval_count":5}` + "\n"))
+	}))
+	defer srv.Close()
+
+	p, err := NewOllamaProvider(OllamaConfig{Host: srv.URL, Model: "tiny", ContextLength: 16384})
+	if err != nil {
+		t.Fatalf("unexpected error building provider: %v", err)
+	}
+	resp, err := p.CreateChatCompletion(context.Background(), &ChatRequest{Messages: []ChatMessage{
+		{Role: ChatRoleSystem, Content: "sys"},
+		{Role: ChatRoleUser, Content: "<p>Hello</p>"},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Content != "# Hello" || resp.TokensUsed != 15 || resp.FinishReason != FinishReasonStop {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if got.Model != "tiny" || got.Stream || len(got.Messages) != 2 || got.Messages[1].Content != "<p>Hello</p>" {
+		t.Errorf("unexpected request %+v", got)
+	}
+	if got.Options["num_ctx"] != float64(16384) {
+		t.Errorf("expected num_ctx 16384, got %v", got.Options["num_ctx"])
+	}
+}
+
+func TestOllamaProviderRequiresModel(t *testing.T) {
+	if _, err := NewOllamaProvider(OllamaConfig{}); !errors.Is(err, ErrOllamaModelRequired) {
+		t.Errorf("expected %v, got %v", ErrOllamaModelRequired, err)
+	}
+}
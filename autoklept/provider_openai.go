@@ -0,0 +1,50 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/cohesion-org/deepseek-go"
+)
+
+var (
+	ErrOpenAIBaseURLRequired = errors.New("a base URL is required for an OpenAI-compatible endpoint")
+	ErrOpenAIModelRequired   = errors.New("a model name is required for an OpenAI-compatible endpoint")
+)
+
+// OpenAIConfig points autoklept at anything speaking the OpenAI chat-completions protocol,
+// e.g. vLLM, a llama.cpp server, or a LiteLLM gateway.
+type OpenAIConfig struct {
+	BaseURL string // Everything before "chat/completions", e.g. "http://localhost:8000/v1".
+	Model   string
+	APIKey  string // Sent as a bearer token. Plenty of self-hosted servers don't need one.
+}
+
+// OpenAIProvider is a Provider for a generic OpenAI-compatible endpoint.
+type OpenAIProvider struct {
+	client *deepseek.Client
+	model  string
+}
+
+func NewOpenAIProvider(cfg OpenAIConfig) (*OpenAIProvider, error) {
+	if cfg.BaseURL == "" {
+		return nil, ErrOpenAIBaseURLRequired
+	}
+	if cfg.Model == "" {
+		return nil, ErrOpenAIModelRequired
+	}
+	if _, err := url.ParseRequestURI(cfg.BaseURL); err != nil {
+		return nil, fmt.Errorf("error parsing OpenAI-compatible base URL: %w", err)
+	}
+	// deepseek-go naively concatenates the base URL and path.
+	base := strings.TrimSuffix(cfg.BaseURL, "/") + "/"
+	// Built directly rather than via deepseek.NewClient, which insists on an API key.
+	return &OpenAIProvider{client: newDeepseekClient(cfg.APIKey, base), model: cfg.Model}, nil
+}
+
+func (p *OpenAIProvider) CreateChatCompletion(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	return createChatCompletion(ctx, p.client, p.model, req)
+}
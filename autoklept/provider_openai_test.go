@@ -0,0 +1,45 @@
+package autoklept
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIProvider(t *testing.T) {
+	var gotAuth, gotModel string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		gotAuth = r.Header.Get("Authorization")
+		var body struct {
+			Model string `json:"model"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		gotModel = body.Model
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"cmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"# Hello"},"finish_reason":"stop"}],"usage":{"total_tokens":7}}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewOpenAIProvider(OpenAIConfig{BaseURL: srv.URL + "/v1", Model: "qwen", APIKey: "secret"})
+	if err != nil {
+		t.Fatalf("unexpected error building provider: %v", err)
+	}
+	resp, err := p.CreateChatCompletion(context.Background(), &ChatRequest{Messages: []ChatMessage{{Role: ChatRoleUser, Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Content != "# Hello" || resp.TokensUsed != 7 || resp.FinishReason != FinishReasonStop {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if gotAuth != "Bearer secret" || gotModel != "qwen" {
+		t.Errorf("unexpected request auth %q model %q", gotAuth, gotModel)
+	}
+}
@@ -0,0 +1,177 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cohesion-org/deepseek-go"
+	"github.com/ollama/ollama/api"
+)
+
+// RetryPolicy is how hard we try again after a retryable error (see IsRetryable), with exponential backoff.
+type RetryPolicy struct {
+	// MaxAttempts includes the first try, so 1 (or anything less) never retries.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, doubling for each one after.
+	BaseDelay time.Duration
+	// MaxDelay caps any one wait. A Retry-After longer than this gives up instead, rather than ignore the server.
+	// Retry-After is honoured on fetches and on DeepSeek or OpenAI-compatible chat completions, but not Ollama's.
+	MaxDelay time.Duration
+	// Jitter is the fraction (0 to 1) of each wait that's randomised, so parallel workers don't retry in lockstep.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is used for fetching and chat completions unless a ClientOption says otherwise.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second, Jitter: 0.5}
+
+// retry calls `fn` until it succeeds, fails for good, or runs out of attempts, returning how many attempts it took.
+func retry[T any](ctx context.Context, p RetryPolicy, fn func() (T, error)) (T, int, error) {
+	for attempt := 1; ; attempt++ {
+		v, err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !IsRetryable(err) {
+			return v, attempt, err
+		}
+		delay, ok := p.delay(attempt, err)
+		if !ok {
+			return v, attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return v, attempt, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// delay is how long to wait after the given (1-based) failed attempt. It's false if the server wants us gone longer
+// than MaxDelay.
+func (p RetryPolicy) delay(attempt int, err error) (time.Duration, bool) {
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay // Also catches the shift overflowing.
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(float64(d) * min(p.Jitter, 1) * rand.Float64())
+	}
+	if ra, ok := retryAfter(err); ok {
+		if p.MaxDelay > 0 && ra > p.MaxDelay {
+			return 0, false
+		}
+		d = max(d, ra)
+	}
+	return d, true
+}
+
+// retryAfterError is a chat completion error, along with the Retry-After header its response came with.
+type retryAfterError struct {
+	err        error
+	retryAfter string
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+// retryAfter reads a Retry-After header off `err`, in either its seconds or its HTTP date form.
+func retryAfter(err error) (time.Duration, bool) {
+	var (
+		ra  string
+		hse *HTTPStatusError
+		rae *retryAfterError
+	)
+	switch {
+	case errors.As(err, &hse) && hse.Header != nil:
+		ra = hse.Header.Get("Retry-After")
+	case errors.As(err, &rae):
+		ra = rae.retryAfter
+	}
+	if ra == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(ra); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second, true
+	}
+	if at, err := http.ParseTime(ra); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// retryingFetcher retries its Fetcher according to its policy, giving each attempt its own timeout and holding it to
+// the host's limits. It's for sitemaps and feeds, whose attempts nobody counts - pages are retried in ExecPromptFor
+// itself, so the attempts make it into the PromptResponse.
+type retryingFetcher struct {
+	fetcher Fetcher
+	policy  RetryPolicy
+	timeout time.Duration // Per attempt.
+	hosts   *hostLimiter  // Nil means no limits.
+}
+
+func (f retryingFetcher) Fetch(ctx context.Context, u *url.URL) ([]byte, error) {
+	bs, _, err := retry(ctx, f.policy, func() ([]byte, error) {
+		return fetchAttempt(ctx, f.fetcher, f.hosts, f.timeout, u)
+	})
+	return bs, err
+}
+
+// retryableStatuses are the status codes that mean "not right now" rather than "no".
+var retryableStatuses = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusTooEarly:            true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// IsRetryable reports whether `err`, from fetching or from an LLM provider, is worth trying again.
+// Transient network failures, per-attempt timeouts, rate limiting and server errors are; 404s, bad requests,
+// oversized bodies, unparseable pages and cancelled contexts aren't, and neither is anything we don't recognise.
+func IsRetryable(err error) bool {
+	switch {
+	case err == nil || errors.Is(err, ErrURLTimeout):
+		return false
+	// A single attempt timing out is worth another go - it's only the deadline for that attempt that's gone.
+	case errors.Is(err, ErrFetchTimeout) || errors.Is(err, ErrChatTimeout):
+		return true
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return false
+	}
+	if code, ok := statusCode(err); ok {
+		return retryableStatuses[code]
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// statusCode digs the HTTP status out of our own errors, and those of the provider libraries.
+func statusCode(err error) (int, bool) {
+	var hse *HTTPStatusError
+	if errors.As(err, &hse) {
+		return hse.StatusCode, true
+	}
+	var dse *deepseek.APIError
+	if errors.As(err, &dse) {
+		return dse.StatusCode, true
+	}
+	var ose api.StatusError
+	if errors.As(err, &ose) {
+		return ose.StatusCode, true
+	}
+	return 0, false
+}
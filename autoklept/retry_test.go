@@ -0,0 +1,177 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cohesion-org/deepseek-go"
+	"github.com/ollama/ollama/api"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "nil", err: nil, expected: false},
+		{name: "429", err: &HTTPStatusError{StatusCode: http.StatusTooManyRequests}, expected: true},
+		{name: "wrapped 503", err: fmt.Errorf("error fetching: %w", &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}), expected: true},
+		{name: "404", err: &HTTPStatusError{StatusCode: http.StatusNotFound}, expected: false},
+		{name: "403", err: &HTTPStatusError{StatusCode: http.StatusForbidden}, expected: false},
+		{name: "deepseek 500", err: &deepseek.APIError{StatusCode: http.StatusInternalServerError}, expected: true},
+		{name: "deepseek 402", err: &deepseek.APIError{StatusCode: http.StatusPaymentRequired}, expected: false},
+		{name: "ollama 502", err: api.StatusError{StatusCode: http.StatusBadGateway}, expected: true},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, expected: true},
+		{name: "unexpected EOF", err: fmt.Errorf("error reading: %w", io.ErrUnexpectedEOF), expected: true},
+		{name: "cancelled", err: fmt.Errorf("error on HTTP request: %w", context.Canceled), expected: false},
+		{name: "deadline", err: context.DeadlineExceeded, expected: false},
+		{name: "chat timeout", err: fmt.Errorf("%w: %w", ErrChatTimeout, context.DeadlineExceeded), expected: true},
+		{name: "fetch timeout", err: fmt.Errorf("%w: %w", ErrFetchTimeout, context.DeadlineExceeded), expected: true},
+		{name: "url timeout", err: fmt.Errorf("%w: %w", ErrURLTimeout, &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}), expected: false},
+		{name: "body too large", err: ErrBodyTooLarge, expected: false},
+		{name: "not found", err: ErrContentNodeNotFound, expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := IsRetryable(tt.err); actual != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond, Jitter: 0.5}
+	unavailable := &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}
+	tests := []struct {
+		name             string
+		errs             []error // Returned in order by each attempt; running out means success.
+		policy           RetryPolicy
+		expectedAttempts int
+		expectedErr      error
+	}{
+		{name: "first try", policy: policy, expectedAttempts: 1},
+		{name: "recovers", errs: []error{unavailable, unavailable}, policy: policy, expectedAttempts: 3},
+		{name: "runs out", errs: []error{unavailable, unavailable, unavailable}, policy: policy, expectedAttempts: 3, expectedErr: ErrNon200ResponseCode},
+		{name: "permanent", errs: []error{&HTTPStatusError{StatusCode: http.StatusNotFound}}, policy: policy, expectedAttempts: 1, expectedErr: ErrNon200ResponseCode},
+		{name: "never retries", errs: []error{unavailable}, expectedAttempts: 1, expectedErr: ErrNon200ResponseCode},
+		{
+			name:             "retry-after too long",
+			errs:             []error{&HTTPStatusError{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"120"}}}},
+			policy:           policy,
+			expectedAttempts: 1,
+			expectedErr:      ErrNon200ResponseCode,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			_, attempts, err := retry(context.Background(), tt.policy, func() (struct{}, error) {
+				calls++
+				if calls <= len(tt.errs) {
+					return struct{}{}, tt.errs[calls-1]
+				}
+				return struct{}{}, nil
+			})
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected err %v, got %v", tt.expectedErr, err)
+			}
+			if attempts != tt.expectedAttempts || calls != tt.expectedAttempts {
+				t.Errorf("expected %d attempts, got %d (%d calls)", tt.expectedAttempts, attempts, calls)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	for attempt, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 80: 10 * time.Second} {
+		if d, _ := p.delay(attempt, nil); d != expected {
+			t.Errorf("attempt %d: expected %v, got %v", attempt, expected, d)
+		}
+	}
+	retryAfter := &HTTPStatusError{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"5"}}}
+	if d, ok := p.delay(1, retryAfter); !ok || d != 5*time.Second {
+		t.Errorf("expected Retry-After to stretch the delay to 5s, got %v", d)
+	}
+	p.Jitter = 0.5
+	for range 100 {
+		if d, _ := p.delay(2, nil); d < time.Second || d > 2*time.Second {
+			t.Fatalf("expected jittered delay in [1s, 2s], got %v", d)
+		}
+	}
+}
+
+func TestExecPromptForRetriesFetch(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`<html><body><p>hello</p></body></html>`))
+	}))
+	defer srv.Close()
+
+	fp := &fakeProvider{content: "ok"}
+	// Every hit counts here, robots.txt included, so it's left out of it.
+	c := NewClient("", WithProvider(&flakyProvider{Provider: fp, failures: 1}), WithRobotsTxt(false),
+		WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second}))
+	pr, err := c.NewPromptRequest(context.Background(), &PromptRequestInput{InputTag: "blog", OutputTag: "markdown"})
+	if err != nil {
+		t.Fatalf("unexpected error building prompt request: %v", err)
+	}
+	resp, err := c.ExecPromptFor(context.Background(), pr, srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error executing prompt: %v", err)
+	}
+	if resp.FetchAttempts != 2 || resp.ChatAttempts != 2 || resp.Content != "ok" {
+		t.Errorf("expected 2 fetch and 2 chat attempts, got %+v", resp)
+	}
+}
+
+// flakyProvider fails with a 500 the first `failures` times, then hands off to the Provider.
+type flakyProvider struct {
+	Provider
+	failures int
+}
+
+func (f *flakyProvider) CreateChatCompletion(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, &deepseek.APIError{StatusCode: http.StatusInternalServerError}
+	}
+	return f.Provider.CreateChatCompletion(ctx, req)
+}
+
+func TestChatRetryAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":{"message":"slow down"}}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewOpenAIProvider(OpenAIConfig{BaseURL: srv.URL + "/v1", Model: "qwen"})
+	if err != nil {
+		t.Fatalf("unexpected error building provider: %v", err)
+	}
+	_, err = p.CreateChatCompletion(context.Background(), &ChatRequest{Messages: []ChatMessage{{Role: ChatRoleUser, Content: "hi"}}})
+	if !IsRetryable(err) {
+		t.Fatalf("expected a retryable error, got %v", err)
+	}
+	if d, ok := retryAfter(err); !ok || d != 7*time.Second {
+		t.Errorf("expected a 7s Retry-After, got %v, %t", d, ok)
+	}
+}
@@ -0,0 +1,235 @@
+package autoklept
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+	ErrRobotsUnreachable  = errors.New("robots.txt unreachable")
+)
+
+// robotsTxt is the parts of a robots.txt we care about.
+type robotsTxt struct {
+	groups   []robotsGroup
+	sitemaps []string // Sitemap: directives apply regardless of user-agent group.
+}
+
+// robotsGroup is one or more User-agent lines, and the rules that follow them.
+type robotsGroup struct {
+	agents     []string // Lowercased.
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string // May use * wildcards and a trailing $ anchor.
+}
+
+// parseRobots is forgiving, like every crawler's has to be: unknown lines are skipped, and rules before any
+// User-agent line are ignored.
+func parseRobots(raw []byte) *robotsTxt {
+	rt := &robotsTxt{}
+	var cur *robotsGroup
+	inAgents := false // Consecutive User-agent lines share a group.
+	sc := bufio.NewScanner(bytes.NewReader(raw))
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, val = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(val)
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				rt.groups = append(rt.groups, robotsGroup{})
+				cur = &rt.groups[len(rt.groups)-1]
+			}
+			cur.agents = append(cur.agents, strings.ToLower(val))
+			inAgents = true
+			continue
+		case "allow", "disallow":
+			// An empty Disallow allows everything, which is what having no rule does anyway.
+			if cur != nil && val != "" {
+				cur.rules = append(cur.rules, robotsRule{allow: key == "allow", pattern: val})
+			}
+		case "crawl-delay":
+			if secs, err := strconv.ParseFloat(val, 64); cur != nil && err == nil && secs > 0 {
+				cur.crawlDelay = time.Duration(secs * float64(time.Second))
+			}
+		case "sitemap":
+			if val != "" {
+				rt.sitemaps = append(rt.sitemaps, val)
+			}
+		}
+		inAgents = false
+	}
+	return rt
+}
+
+// group picks the rules for `userAgent`: the group naming the longest matching product token, else the * group.
+// Groups naming the same agent are merged, as the spec asks.
+func (rt *robotsTxt) group(userAgent string) robotsGroup {
+	ua := strings.ToLower(userAgent)
+	var best robotsGroup
+	bestLen := -1
+	for _, g := range rt.groups {
+		for _, a := range g.agents {
+			l := len(a)
+			switch {
+			case a == "*":
+				l = 0
+			case a == "" || !strings.Contains(ua, a):
+				continue
+			}
+			if l > bestLen {
+				best, bestLen = robotsGroup{agents: []string{a}}, l
+			}
+			if l == bestLen && best.agents[0] == a {
+				best.rules = append(best.rules, g.rules...)
+				best.crawlDelay = max(best.crawlDelay, g.crawlDelay)
+			}
+		}
+	}
+	return best
+}
+
+// allowed applies the longest matching rule, with Allow winning ties. No matching rule means allowed.
+func (g robotsGroup) allowed(u *url.URL) bool {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	allow, matched := true, -1
+	for _, r := range g.rules {
+		if !robotsMatch(r.pattern, path) {
+			continue
+		}
+		if l := len(r.pattern); l > matched || (l == matched && r.allow) {
+			allow, matched = r.allow, l
+		}
+	}
+	return allow
+}
+
+// robotsMatch matches a robots.txt path pattern, which is a prefix match with * wildcards and an optional $ anchor.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || rest == ""
+	}
+	for i, p := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return strings.HasSuffix(rest, p)
+		}
+		idx := strings.Index(rest, p)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(p):]
+	}
+	return true
+}
+
+// robotsRecheck is how long an unreachable robots.txt keeps its host disallowed before we try it again.
+const robotsRecheck = time.Minute
+
+// robotsChecker fetches each host's robots.txt once, and answers whether URLs on it may be fetched.
+type robotsChecker struct {
+	fetcher   Fetcher
+	userAgent string
+	// onCrawlDelay is told about each host's Crawl-delay, the first time we see it.
+	onCrawlDelay func(host string, d time.Duration)
+	recheck      time.Duration // robotsRecheck, outside of tests.
+	mu           sync.Mutex
+	hosts        map[string]*robotsHost
+}
+
+type robotsHost struct {
+	mu          sync.Mutex
+	loaded      bool
+	unreachable bool
+	expires     time.Time // When to fetch robots.txt again. Zero means never.
+	group       robotsGroup
+}
+
+func newRobotsChecker(f Fetcher, userAgent string, onCrawlDelay func(string, time.Duration)) *robotsChecker {
+	return &robotsChecker{fetcher: f, userAgent: userAgent, onCrawlDelay: onCrawlDelay, recheck: robotsRecheck, hosts: map[string]*robotsHost{}}
+}
+
+// allowed is false with ErrRobotsUnreachable while the host's robots.txt can't be had, which isn't a disallow as
+// such, but doesn't let us fetch anything either.
+func (rc *robotsChecker) allowed(ctx context.Context, u *url.URL) (bool, error) {
+	key := u.Scheme + "://" + u.Host
+	rc.mu.Lock()
+	h, ok := rc.hosts[key]
+	if !ok {
+		h = &robotsHost{}
+		rc.hosts[key] = h
+	}
+	rc.mu.Unlock()
+	// Holding the host's lock while loading means everyone else waits for the one fetch, rather than making their own.
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.loaded || (!h.expires.IsZero() && !time.Now().Before(h.expires)) {
+		g, unreachable, err := rc.load(ctx, u)
+		if err != nil {
+			return false, err
+		}
+		h.group, h.loaded, h.unreachable, h.expires = g, true, unreachable, time.Time{}
+		if unreachable {
+			h.expires = time.Now().Add(rc.recheck)
+		}
+		if g.crawlDelay > 0 && rc.onCrawlDelay != nil {
+			rc.onCrawlDelay(u.Host, g.crawlDelay)
+		}
+	}
+	if h.unreachable {
+		return false, fmt.Errorf("%w for %s", ErrRobotsUnreachable, u.Host)
+	}
+	return h.group.allowed(u), nil
+}
+
+// load follows the spec on failures: a robots.txt that's missing (a 4xx) allows everything, but one we can't get at
+// - a 5xx, a 429, a timeout or a network error - disallows everything, since the site may well be telling us to back
+// off. That's only for now though, and it's reported as `unreachable` so it can be tried again later. Only our own
+// context giving up is an error, so that it isn't remembered for the host at all.
+func (rc *robotsChecker) load(ctx context.Context, u *url.URL) (g robotsGroup, unreachable bool, err error) {
+	raw, err := rc.fetcher.Fetch(ctx, &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"})
+	switch {
+	case err == nil:
+		return parseRobots(raw).group(rc.userAgent), false, nil
+	case ctx.Err() != nil:
+		return robotsGroup{}, false, ctx.Err()
+	}
+	if code, ok := statusCode(err); ok && code >= http.StatusBadRequest && code < http.StatusInternalServerError &&
+		code != http.StatusTooManyRequests {
+		return robotsGroup{}, false, nil
+	}
+	return robotsGroup{rules: []robotsRule{{pattern: "/"}}}, true, nil
+}
@@ -0,0 +1,167 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const robotsTestTxt = `# comments are fine
+Sitemap: https://example.com/sitemap.xml
+
+User-agent: *
+Disallow: /private/
+Disallow: /*.pdf$
+Allow: /private/public-bits
+Crawl-delay: 2
+
+User-agent: BadBot
+Disallow: /
+
+User-agent: autoklept
+User-agent: otherbot
+Disallow: /drafts
+Allow: /drafts/published
+
+User-agent: autoklept
+Crawl-delay: 0.5
+`
+
+func TestRobotsAllowed(t *testing.T) {
+	rt := parseRobots([]byte(robotsTestTxt))
+	if len(rt.sitemaps) != 1 || rt.sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("unexpected sitemaps %v", rt.sitemaps)
+	}
+	tests := []struct {
+		name      string
+		userAgent string
+		path      string
+		expected  bool
+	}{
+		{name: "star group disallow", userAgent: "SomeBrowser/1.0", path: "/private/secret", expected: false},
+		{name: "star group longer allow", userAgent: "SomeBrowser/1.0", path: "/private/public-bits/1", expected: true},
+		{name: "wildcard and anchor", userAgent: "SomeBrowser/1.0", path: "/files/report.pdf", expected: false},
+		{name: "anchor doesn't match more", userAgent: "SomeBrowser/1.0", path: "/files/report.pdf.html", expected: true},
+		{name: "no rule", userAgent: "SomeBrowser/1.0", path: "/blog/post", expected: true},
+		{name: "banned bot", userAgent: "Mozilla/5.0 (compatible; BadBot/2.1)", path: "/blog/post", expected: false},
+		{name: "robots.txt always allowed", userAgent: "BadBot", path: "/robots.txt", expected: true},
+		{name: "our group replaces star", userAgent: DefaultUserAgent, path: "/private/secret", expected: true},
+		{name: "our group disallow", userAgent: DefaultUserAgent, path: "/drafts/wip", expected: false},
+		{name: "our group allow", userAgent: DefaultUserAgent, path: "/drafts/published/1", expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse("https://example.com" + tt.path)
+			if actual := rt.group(tt.userAgent).allowed(u); actual != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, actual)
+			}
+		})
+	}
+	if d := rt.group(DefaultUserAgent).crawlDelay; d != 500*time.Millisecond {
+		t.Errorf("expected merged groups' crawl delay of 500ms, got %v", d)
+	}
+}
+
+func TestExecPromptForRobots(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /private\nCrawl-delay: 3\n"))
+			return
+		}
+		_, _ = w.Write([]byte(`<html><body><p>hello</p></body></html>`))
+	}))
+	defer srv.Close()
+	srvURL, _ := url.Parse(srv.URL)
+
+	tests := []struct {
+		name        string
+		path        string
+		opts        []ClientOption
+		expectedErr error
+	}{
+		{name: "allowed", path: "/blog/post"},
+		{name: "disallowed", path: "/private/page", expectedErr: ErrDisallowedByRobots},
+		{name: "opted out", path: "/private/page", opts: []ClientOption{WithRobotsTxt(false)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient("", append([]ClientOption{WithProvider(&fakeProvider{content: "ok"})}, tt.opts...)...)
+			pr, err := c.NewPromptRequest(context.Background(), &PromptRequestInput{InputTag: "blog", OutputTag: "markdown"})
+			if err != nil {
+				t.Fatalf("unexpected error building prompt request: %v", err)
+			}
+			_, err = c.ExecPromptFor(context.Background(), pr, srv.URL+tt.path)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected err %v, got %v", tt.expectedErr, err)
+			}
+			if c.robots != nil && c.hosts.forHost(srvURL.Host).every != 3*time.Second {
+				t.Errorf("expected the Crawl-delay to slow the host down to 3s, got %v", c.hosts.forHost(srvURL.Host).every)
+			}
+		})
+	}
+}
+
+// robotsFetcher serves robots.txt as told, one response per fetch, and then the last one forever.
+type robotsFetcher struct {
+	mu      sync.Mutex
+	errs    []error // Nil for a successful fetch of `body`.
+	body    string
+	fetches int
+}
+
+func (f *robotsFetcher) Fetch(_ context.Context, _ *url.URL) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := f.errs[min(f.fetches, len(f.errs)-1)]
+	f.fetches++
+	if err != nil {
+		return nil, err
+	}
+	return []byte(f.body), nil
+}
+
+func TestRobotsUnreachable(t *testing.T) {
+	tests := []struct {
+		name            string
+		err             error
+		expectedAllowed bool
+		expectedErr     error
+		expectedFetches int // After checking twice within the recheck window, then again after it.
+	}{
+		{name: "missing", err: &HTTPStatusError{StatusCode: http.StatusNotFound}, expectedAllowed: true, expectedFetches: 1},
+		{name: "rate limited", err: &HTTPStatusError{StatusCode: http.StatusTooManyRequests}, expectedErr: ErrRobotsUnreachable, expectedFetches: 2},
+		{name: "server error", err: &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}, expectedErr: ErrRobotsUnreachable, expectedFetches: 2},
+		{name: "timeout", err: fmt.Errorf("%w after 30s: %w", ErrFetchTimeout, context.DeadlineExceeded), expectedErr: ErrRobotsUnreachable, expectedFetches: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &robotsFetcher{errs: []error{tt.err, nil}, body: "User-agent: *\nDisallow: /private\n"}
+			rc := newRobotsChecker(f, DefaultUserAgent, nil)
+			rc.recheck = 20 * time.Millisecond
+			u, _ := url.Parse("https://example.com/blog/post")
+			for range 2 {
+				allowed, err := rc.allowed(context.Background(), u)
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("expected err %v, got %v", tt.expectedErr, err)
+				}
+				if allowed != tt.expectedAllowed {
+					t.Errorf("expected allowed %t while robots.txt is %v, got %t", tt.expectedAllowed, tt.err, allowed)
+				}
+			}
+			time.Sleep(30 * time.Millisecond)
+			// Once robots.txt is back, what it says goes.
+			if allowed, err := rc.allowed(context.Background(), u); err != nil || !allowed {
+				t.Errorf("expected allowed after robots.txt came back, got %t, %v", allowed, err)
+			}
+			if f.fetches != tt.expectedFetches {
+				t.Errorf("expected %d robots.txt fetches, got %d", tt.expectedFetches, f.fetches)
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+package autoklept
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	ErrInvalidSelector = errors.New("invalid CSS selector")
+)
+
+// Selector is a CSS selector, evaluated directly over a golang.org/x/net/html tree.
+// It supports the subset that's actually useful for pointing at a blog's content container:
+//   - type, universal, #id and .class selectors, e.g. `article`, `*`, `#main`, `div.post.entry`
+//   - attribute selectors: [attr], [attr=val], [attr~=val], [attr|=val], [attr^=val], [attr$=val], [attr*=val]
+//   - descendant (`A B`) and child (`A > B`) combinators
+//   - :nth-child(an+b), including odd and even
+//   - selector lists, e.g. `article, main`
+type Selector struct {
+	raw    string
+	groups []complexSelector
+}
+
+// complexSelector is compounds joined by combinators, where combinators[i] sits between compounds[i] and compounds[i+1].
+type complexSelector struct {
+	compounds   []compoundSelector
+	combinators []byte // ' ' for descendant, '>' for child.
+}
+
+type compoundSelector struct {
+	tag      string // Empty matches any element.
+	id       string
+	classes  []string
+	attrs    []attrSelector
+	nthChild []nthChild
+}
+
+type attrSelector struct {
+	key string
+	op  string // Empty means the attribute just has to exist.
+	val string
+}
+
+// nthChild matches the element's 1-based position among its element siblings against a*n+b, for some n >= 0.
+type nthChild struct {
+	a, b int
+}
+
+// ParseSelector parses a CSS selector into something that can be run against parsed HTML.
+func ParseSelector(s string) (*Selector, error) {
+	p := &selectorParser{s: s}
+	groups, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("%w '%s': %v", ErrInvalidSelector, s, err)
+	}
+	return &Selector{raw: s, groups: groups}, nil
+}
+
+// MustParseSelector is ParseSelector for selectors known to be good at compile time.
+func MustParseSelector(s string) *Selector {
+	sel, err := ParseSelector(s)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+func (s *Selector) String() string {
+	return s.raw
+}
+
+// FindNode returns the first node in document order matching the selector, or nil.
+func (s *Selector) FindNode(doc *html.Node) *html.Node {
+	if s.Match(doc) {
+		return doc
+	}
+	for c := doc.FirstChild; c != nil; c = c.NextSibling {
+		if found := s.FindNode(c); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Match reports whether `n` itself matches the selector.
+func (s *Selector) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, g := range s.groups {
+		if g.match(n, len(g.compounds)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// match works right-to-left, as browsers do: compounds[i] must match n, and everything left of it an ancestor.
+func (cs complexSelector) match(n *html.Node, i int) bool {
+	if !cs.compounds[i].match(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch cs.combinators[i-1] {
+	case '>':
+		p := parentElement(n)
+		return p != nil && cs.match(p, i-1)
+	default:
+		for p := parentElement(n); p != nil; p = parentElement(p) {
+			if cs.match(p, i-1) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (c compoundSelector) match(n *html.Node) bool {
+	if c.tag != "" && c.tag != n.Data {
+		return false
+	}
+	if c.id != "" && getAttr(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		have := strings.Fields(getAttr(n, "class"))
+		for _, want := range c.classes {
+			if !containsString(have, want) {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		if !a.match(n) {
+			return false
+		}
+	}
+	for _, nc := range c.nthChild {
+		if !nc.match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a attrSelector) match(n *html.Node) bool {
+	val, ok := lookupAttr(n, a.key)
+	if !ok {
+		return false
+	}
+	switch a.op {
+	case "":
+		return true
+	case "=":
+		return val == a.val
+	case "~=":
+		return containsString(strings.Fields(val), a.val)
+	case "|=":
+		return val == a.val || strings.HasPrefix(val, a.val+"-")
+	case "^=":
+		return a.val != "" && strings.HasPrefix(val, a.val)
+	case "$=":
+		return a.val != "" && strings.HasSuffix(val, a.val)
+	case "*=":
+		return a.val != "" && strings.Contains(val, a.val)
+	default:
+		return false
+	}
+}
+
+func (nc nthChild) match(n *html.Node) bool {
+	pos := 1
+	for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+		if s.Type == html.ElementNode {
+			pos++
+		}
+	}
+	if nc.a == 0 {
+		return pos == nc.b
+	}
+	diff := pos - nc.b
+	return diff%nc.a == 0 && diff/nc.a >= 0
+}
+
+func parentElement(n *html.Node) *html.Node {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode {
+			return p
+		}
+	}
+	return nil
+}
+
+func lookupAttr(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Namespace == "" && attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+func getAttr(n *html.Node, key string) string {
+	val, _ := lookupAttr(n, key)
+	return val
+}
+
+func containsString(ss []string, s string) bool {
+	for _, have := range ss {
+		if have == s {
+			return true
+		}
+	}
+	return false
+}
+
+// selectorParser is a small hand-rolled recursive descent parser over the selector string.
+type selectorParser struct {
+	s   string
+	pos int
+}
+
+func (p *selectorParser) parse() ([]complexSelector, error) {
+	var groups []complexSelector
+	for {
+		p.skipSpace()
+		cs, err := p.parseComplex()
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, cs)
+		p.skipSpace()
+		if p.done() {
+			return groups, nil
+		}
+		if p.peek() != ',' {
+			return nil, fmt.Errorf("unexpected '%c' at %d", p.peek(), p.pos)
+		}
+		p.pos++
+	}
+}
+
+func (p *selectorParser) parseComplex() (complexSelector, error) {
+	var cs complexSelector
+	for {
+		c, err := p.parseCompound()
+		if err != nil {
+			return cs, err
+		}
+		cs.compounds = append(cs.compounds, c)
+		hadSpace := p.skipSpace()
+		if p.done() || p.peek() == ',' {
+			return cs, nil
+		}
+		switch {
+		case p.peek() == '>':
+			p.pos++
+			p.skipSpace()
+			cs.combinators = append(cs.combinators, '>')
+		case hadSpace:
+			cs.combinators = append(cs.combinators, ' ')
+		default:
+			return cs, fmt.Errorf("unexpected '%c' at %d", p.peek(), p.pos)
+		}
+	}
+}
+
+func (p *selectorParser) parseCompound() (compoundSelector, error) {
+	var c compoundSelector
+	start := p.pos
+	if !p.done() && p.peek() == '*' {
+		p.pos++
+	} else if isIdentChar(p.peekOrZero()) {
+		c.tag = strings.ToLower(p.parseIdent())
+	}
+	for !p.done() {
+		switch p.peek() {
+		case '#':
+			p.pos++
+			if c.id = p.parseIdent(); c.id == "" {
+				return c, fmt.Errorf("expected id at %d", p.pos)
+			}
+		case '.':
+			p.pos++
+			class := p.parseIdent()
+			if class == "" {
+				return c, fmt.Errorf("expected class at %d", p.pos)
+			}
+			c.classes = append(c.classes, class)
+		case '[':
+			a, err := p.parseAttr()
+			if err != nil {
+				return c, err
+			}
+			c.attrs = append(c.attrs, a)
+		case ':':
+			nc, err := p.parsePseudo()
+			if err != nil {
+				return c, err
+			}
+			c.nthChild = append(c.nthChild, nc)
+		default:
+			if p.pos == start {
+				return c, fmt.Errorf("unexpected '%c' at %d", p.peek(), p.pos)
+			}
+			return c, nil
+		}
+	}
+	if p.pos == start {
+		return c, fmt.Errorf("expected selector at %d", p.pos)
+	}
+	return c, nil
+}
+
+func (p *selectorParser) parseAttr() (attrSelector, error) {
+	var a attrSelector
+	p.pos++ // '['
+	p.skipSpace()
+	if a.key = strings.ToLower(p.parseIdent()); a.key == "" {
+		return a, fmt.Errorf("expected attribute name at %d", p.pos)
+	}
+	p.skipSpace()
+	if p.done() {
+		return a, errors.New("unterminated attribute selector")
+	}
+	if p.peek() == ']' {
+		p.pos++
+		return a, nil
+	}
+	for _, op := range []string{"=", "~=", "|=", "^=", "$=", "*="} {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			a.op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if a.op == "" {
+		return a, fmt.Errorf("unknown attribute operator at %d", p.pos)
+	}
+	p.skipSpace()
+	if p.done() {
+		return a, errors.New("unterminated attribute selector")
+	}
+	if q := p.peek(); q == '"' || q == '\'' {
+		end := strings.IndexByte(p.s[p.pos+1:], q)
+		if end < 0 {
+			return a, errors.New("unterminated string in attribute selector")
+		}
+		a.val = p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+	} else if a.val = p.parseIdent(); a.val == "" {
+		return a, fmt.Errorf("expected attribute value at %d", p.pos)
+	}
+	p.skipSpace()
+	if p.done() || p.peek() != ']' {
+		return a, errors.New("unterminated attribute selector")
+	}
+	p.pos++
+	return a, nil
+}
+
+func (p *selectorParser) parsePseudo() (nthChild, error) {
+	const prefix = ":nth-child("
+	if !strings.HasPrefix(strings.ToLower(p.s[p.pos:]), prefix) {
+		return nthChild{}, fmt.Errorf("unsupported pseudo-class at %d", p.pos)
+	}
+	p.pos += len(prefix)
+	end := strings.IndexByte(p.s[p.pos:], ')')
+	if end < 0 {
+		return nthChild{}, errors.New("unterminated :nth-child")
+	}
+	nc, err := parseNth(p.s[p.pos : p.pos+end])
+	if err != nil {
+		return nthChild{}, err
+	}
+	p.pos += end + 1
+	return nc, nil
+}
+
+// parseNth parses the an+b microsyntax: "odd", "even", "3", "n", "-n+3", "2n+1", "2n - 1", etc.
+func parseNth(s string) (nthChild, error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	switch s {
+	case "odd":
+		return nthChild{a: 2, b: 1}, nil
+	case "even":
+		return nthChild{a: 2, b: 0}, nil
+	}
+	aStr, bStr, hasN := strings.Cut(s, "n")
+	if !hasN {
+		b, err := strconv.Atoi(s)
+		if err != nil {
+			return nthChild{}, fmt.Errorf("invalid :nth-child argument '%s'", s)
+		}
+		return nthChild{b: b}, nil
+	}
+	var nc nthChild
+	switch aStr {
+	case "", "+":
+		nc.a = 1
+	case "-":
+		nc.a = -1
+	default:
+		a, err := strconv.Atoi(aStr)
+		if err != nil {
+			return nthChild{}, fmt.Errorf("invalid :nth-child argument '%s'", s)
+		}
+		nc.a = a
+	}
+	if bStr != "" {
+		if bStr[0] != '+' && bStr[0] != '-' {
+			return nthChild{}, fmt.Errorf("invalid :nth-child argument '%s'", s)
+		}
+		b, err := strconv.Atoi(bStr)
+		if err != nil {
+			return nthChild{}, fmt.Errorf("invalid :nth-child argument '%s'", s)
+		}
+		nc.b = b
+	}
+	return nc, nil
+}
+
+func (p *selectorParser) parseIdent() string {
+	start := p.pos
+	for !p.done() && isIdentChar(p.peek()) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for !p.done() && strings.IndexByte(" \t\n\r\f", p.peek()) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func (p *selectorParser) done() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *selectorParser) peek() byte {
+	return p.s[p.pos]
+}
+
+func (p *selectorParser) peekOrZero() byte {
+	if p.done() {
+		return 0
+	}
+	return p.peek()
+}
+
+func isIdentChar(b byte) bool {
+	return b == '-' || b == '_' || b >= 0x80 ||
+		('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9')
+}
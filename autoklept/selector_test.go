@@ -0,0 +1,94 @@
+package autoklept
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const selectorTestDoc = `<html><body>
+<div id="SITE_CONTAINER" class="wrapper">
+  <nav class="menu"><ul><li>home</li><li>about</li></ul></nav>
+  <article class="post entry" data-kind="blog-post" lang="en-US">
+    <h1>Title</h1>
+    <div class="entry-content"><p>one</p><p>two</p><p>three</p><p>four</p></div>
+  </article>
+  <aside><div class="entry-content"><p>sidebar</p></div></aside>
+</div>
+</body></html>`
+
+func TestSelectorFindNode(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(selectorTestDoc))
+	if err != nil {
+		t.Fatalf("unexpected error parsing doc: %v", err)
+	}
+	tests := []struct {
+		name     string
+		selector string
+		expected string // Rendered text content of the first match, or "" for no match.
+	}{
+		{name: "tag", selector: "h1", expected: "Title"},
+		{name: "id", selector: "#SITE_CONTAINER nav li", expected: "home"},
+		{name: "tag and id", selector: "div#SITE_CONTAINER > nav", expected: "homeabout"},
+		{name: "classes", selector: "article.entry.post h1", expected: "Title"},
+		{name: "missing class", selector: "article.page", expected: ""},
+		{name: "child combinator", selector: "article > .entry-content", expected: "onetwothreefour"},
+		{name: "child combinator skips grandchildren", selector: "#SITE_CONTAINER > .entry-content", expected: ""},
+		{name: "descendant", selector: "aside .entry-content", expected: "sidebar"},
+		{name: "attr exists", selector: "[data-kind]", expected: "Titleonetwothreefour"},
+		{name: "attr equals quoted", selector: `article[data-kind="blog-post"] h1`, expected: "Title"},
+		{name: "attr prefix", selector: "[data-kind^=blog] h1", expected: "Title"},
+		{name: "attr suffix", selector: "[data-kind$='post'] h1", expected: "Title"},
+		{name: "attr substring", selector: "[data-kind*=g-p] h1", expected: "Title"},
+		{name: "attr word", selector: "[class~=entry] h1", expected: "Title"},
+		{name: "attr dash", selector: "[lang|=en] h1", expected: "Title"},
+		{name: "nth-child number", selector: ".entry-content p:nth-child(3)", expected: "three"},
+		{name: "nth-child even", selector: "article p:nth-child(even)", expected: "two"},
+		{name: "nth-child formula", selector: "article p:nth-child(2n + 3)", expected: "three"},
+		{name: "nth-child negative", selector: "li:nth-child(-n+1)", expected: "home"},
+		{name: "list", selector: "section, aside p", expected: "sidebar"},
+		{name: "universal", selector: "article > *", expected: "Title"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel, err := ParseSelector(tt.selector)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			found := sel.FindNode(doc)
+			if tt.expected == "" {
+				if found != nil {
+					t.Errorf("expected no match, got <%s>", found.Data)
+				}
+				return
+			}
+			if found == nil {
+				t.Fatalf("expected a match for %q", tt.selector)
+			}
+			if actual := textContent(found); actual != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseSelectorInvalid(t *testing.T) {
+	for _, s := range []string{"", "div >", "a,", "[href", "[href!=x]", "p:hover", "p:nth-child(x)", ".", "div#"} {
+		if _, err := ParseSelector(s); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("expected %v for %q, got %v", ErrInvalidSelector, s, err)
+		}
+	}
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return strings.TrimSpace(n.Data)
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textContent(c))
+	}
+	return sb.String()
+}
@@ -1,12 +1,238 @@
 package autoklept
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-// TODO: We could parse these and recursively get all sub-sitemaps and their URLs
+const (
+	// MaxSitemapDepth is how many levels of nested <sitemapindex> we'll follow before giving up.
+	MaxSitemapDepth = 5
+	// MaxSitemapFetches is how many sitemaps we'll fetch at once while walking an index.
+	MaxSitemapFetches = 4
+
+	// MaxSitemapBytes is the protocol's limit on an uncompressed sitemap, which also keeps a gzip bomb in check.
+	MaxSitemapBytes = 50 * 1024 * 1024
+
+	sitemapRootIndex  = "sitemapindex"
+	sitemapRootURLSet = "urlset"
+)
+
+var (
+	ErrSitemapTooDeep     = errors.New("sitemap index nesting exceeds max depth")
+	ErrUnknownSitemapRoot = errors.New("unknown sitemap root element")
+	ErrSitemapTooLarge    = errors.New("sitemap exceeds max uncompressed size")
+	ErrInvalidTextSitemap = errors.New("invalid line in text sitemap")
+)
+
+// SitemapChildrenError comes back alongside everything that did parse, when some of an index's child sitemaps
+// couldn't be fetched or parsed. Yoast and WordPress indexes list stale children often enough that one dead child
+// shouldn't sink the rest.
+type SitemapChildrenError struct {
+	Errs []error
+}
+
+func (e *SitemapChildrenError) Error() string {
+	return fmt.Sprintf("%d child sitemap(s) failed: %v", len(e.Errs), errors.Join(e.Errs...))
+}
+
+func (e *SitemapChildrenError) Unwrap() []error {
+	return e.Errs
+}
+
+// childErrors splits `err` into the children skipped by a *SitemapChildrenError, and anything worse.
+func childErrors(err error) ([]error, error) {
+	var sce *SitemapChildrenError
+	if errors.As(err, &sce) {
+		return sce.Errs, nil
+	}
+	return nil, err
+}
+
+// SitemapEntry is a single <url> from a sitemap, with whatever optional metadata the site bothered to publish.
+type SitemapEntry struct {
+	Loc        url.URL
+	LastMod    time.Time // Zero if absent or unparseable.
+	ChangeFreq string
+	Priority   float64 // Zero if absent; the protocol's implied default is 0.5.
+}
+
+// ParseSitemapURLs doesn't require any LLM.
+// Sitemap indexes (what WordPress, Yoast, Wix etc. serve at /sitemap.xml) are walked recursively,
+// and all the URLs from every child sitemap are returned flattened and de-duplicated.
+// Gzipped (sitemap.xml.gz) and plain-text (one URL per line) sitemaps are detected from the body itself,
+// since servers mislabel their Content-Type far too often to trust it.
+// If some children of an index fail, the rest are still returned, along with a *SitemapChildrenError.
+func ParseSitemapURLs(ctx context.Context, sitemapURL string) ([]url.URL, error) {
+	return parseSitemapURLs(ctx, defaultSourceFetcher, sitemapURL)
+}
+
+// ParseSitemapURLs is the package-level ParseSitemapURLs, fetching with the Client's Fetcher.
+func (c *Client) ParseSitemapURLs(ctx context.Context, sitemapURL string) ([]url.URL, error) {
+	return parseSitemapURLs(ctx, c.sourceFetcher(), sitemapURL)
+}
+
+func parseSitemapURLs(ctx context.Context, f Fetcher, sitemapURL string) ([]url.URL, error) {
+	entries, err := parseSitemapEntries(ctx, f, sitemapURL)
+	if entries == nil && err != nil {
+		return nil, err
+	}
+	urls := make([]url.URL, 0, len(entries))
+	for _, e := range entries {
+		urls = append(urls, e.Loc)
+	}
+	return urls, err
+}
+
+// ParseSitemapEntries is ParseSitemapURLs, but keeps each URL's sitemap metadata (notably lastmod).
+func ParseSitemapEntries(ctx context.Context, sitemapURL string) ([]SitemapEntry, error) {
+	return parseSitemapEntries(ctx, defaultSourceFetcher, sitemapURL)
+}
+
+// ParseSitemapEntries is the package-level ParseSitemapEntries, fetching with the Client's Fetcher.
+func (c *Client) ParseSitemapEntries(ctx context.Context, sitemapURL string) ([]SitemapEntry, error) {
+	return parseSitemapEntries(ctx, c.sourceFetcher(), sitemapURL)
+}
+
+func parseSitemapEntries(ctx context.Context, f Fetcher, sitemapURL string) ([]SitemapEntry, error) {
+	w := &sitemapWalker{
+		fetcher: f,
+		fetches: make(chan struct{}, MaxSitemapFetches),
+		seen:    map[string]bool{},
+	}
+	entries, err := w.walk(ctx, sitemapURL, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(w.failed) > 0 {
+		return dedupeEntries(entries), &SitemapChildrenError{Errs: w.failed}
+	}
+	return dedupeEntries(entries), nil
+}
+
+type sitemapWalker struct {
+	fetcher Fetcher
+	fetches chan struct{} // Bounds concurrent fetches across the whole walk.
+	mu      sync.Mutex
+	seen    map[string]bool // Sitemaps we've already started on, so an index can't cycle back on itself.
+	failed  []error         // Children we skipped past.
+}
+
+func (w *sitemapWalker) walk(ctx context.Context, sitemapURL string, depth int) ([]SitemapEntry, error) {
+	if depth > MaxSitemapDepth {
+		return nil, fmt.Errorf("%w (%d): %s", ErrSitemapTooDeep, MaxSitemapDepth, sitemapURL)
+	}
+	if !w.markSeen(sitemapURL) {
+		return nil, nil
+	}
+	u, err := url.Parse(sitemapURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing sitemap URL: %w", err)
+	}
+	select {
+	case w.fetches <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	sitemapRaw, err := w.fetcher.Fetch(ctx, u)
+	<-w.fetches
+	if err != nil {
+		return nil, fmt.Errorf("error getting sitemap from URL: %w", err)
+	}
+	sitemapRaw, err = maybeGunzip(sitemapRaw)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing sitemap %s: %w", sitemapURL, err)
+	}
+	if isTextSitemap(sitemapRaw) {
+		return extractTextSitemap(sitemapRaw)
+	}
+	root, err := detectRootElement(sitemapRaw)
+	if err != nil {
+		return nil, fmt.Errorf("error detecting sitemap type for %s: %w", sitemapURL, err)
+	}
+	switch root {
+	case sitemapRootURLSet:
+		return extractUrlSet(sitemapRaw)
+	case sitemapRootIndex:
+		children, err := extractSitemapIndex(sitemapRaw)
+		if err != nil {
+			return nil, err
+		}
+		return w.walkChildren(ctx, children, depth+1)
+	default:
+		return nil, fmt.Errorf("%w '%s': %s", ErrUnknownSitemapRoot, root, sitemapURL)
+	}
+}
+
+// walkChildren fetches child sitemaps concurrently, but keeps their entries in index order. Children that fail are
+// skipped and remembered, unless they all fail - then there's nothing to show for the index, and that's an error.
+func (w *sitemapWalker) walkChildren(ctx context.Context, children []string, depth int) ([]SitemapEntry, error) {
+	results := make([][]SitemapEntry, len(children))
+	errs := make([]error, len(children))
+	var wg sync.WaitGroup
+	for i, child := range children {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = w.walk(ctx, child, depth)
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var entries []SitemapEntry
+	var failed []error
+	for i, r := range results {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+			continue
+		}
+		entries = append(entries, r...)
+	}
+	if len(failed) == len(children) && len(children) > 0 {
+		return nil, errors.Join(failed...)
+	}
+	w.mu.Lock()
+	w.failed = append(w.failed, failed...)
+	w.mu.Unlock()
+	return entries, nil
+}
+
+func (w *sitemapWalker) markSeen(sitemapURL string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.seen[sitemapURL] {
+		return false
+	}
+	w.seen[sitemapURL] = true
+	return true
+}
+
+func dedupeEntries(entries []SitemapEntry) []SitemapEntry {
+	seen := make(map[string]bool, len(entries))
+	var deduped []SitemapEntry
+	for _, e := range entries {
+		if seen[e.Loc.String()] {
+			continue
+		}
+		seen[e.Loc.String()] = true
+		deduped = append(deduped, e)
+	}
+	return deduped
+}
+
 type sitemapIndex struct {
 	Sitemaps []sitemap `xml:"sitemap"`
 }
@@ -21,31 +247,73 @@ type urlSet struct {
 }
 
 type singleURL struct {
-	Loc     string `xml:"loc"`
-	LastMod string `xml:"lastmod"`
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod"`
+	ChangeFreq string `xml:"changefreq"`
+	Priority   string `xml:"priority"`
 }
 
-func extractUrlSet(raw []byte) ([]url.URL, error) {
+func extractUrlSet(raw []byte) ([]SitemapEntry, error) {
 	var us urlSet
 	if err := xml.Unmarshal(raw, &us); err != nil {
 		return nil, fmt.Errorf("error unmarshaling sitemap: %w", err)
 	}
-	var urls []url.URL
+	var entries []SitemapEntry
 	for _, u := range us.URLs {
-		up, err := url.Parse(u.Loc)
+		up, err := url.Parse(strings.TrimSpace(u.Loc))
 		if err != nil {
 			return nil, fmt.Errorf("error parsing sitemap url %s: %w", u.Loc, err)
 		}
-		urls = append(urls, *up)
+		// Sites get priority wrong all the time, and it's only a hint anyway - don't fail over it.
+		priority, _ := strconv.ParseFloat(strings.TrimSpace(u.Priority), 64)
+		entries = append(entries, SitemapEntry{
+			Loc:        *up,
+			LastMod:    parseLastMod(u.LastMod),
+			ChangeFreq: strings.TrimSpace(u.ChangeFreq),
+			Priority:   priority,
+		})
+	}
+	return entries, nil
+}
+
+// lastModLayouts are the W3C Datetime variants the sitemaps protocol allows, plus a couple seen in the wild.
+var lastModLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// parseLastMod returns the zero time for a missing or unparseable lastmod, so callers treat it as unknown.
+func parseLastMod(raw string) time.Time {
+	raw = strings.TrimSpace(raw)
+	for _, layout := range lastModLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func extractSitemapIndex(raw []byte) ([]string, error) {
+	var si sitemapIndex
+	if err := xml.Unmarshal(raw, &si); err != nil {
+		return nil, fmt.Errorf("error unmarshaling sitemap index: %w", err)
 	}
-	return urls, nil
+	var locs []string
+	for _, sm := range si.Sitemaps {
+		locs = append(locs, strings.TrimSpace(sm.Loc))
+	}
+	return locs, nil
 }
 
 type RootDetector struct {
 	XMLName xml.Name
 }
 
-// TODO: partial unmarshal to determine what kind of sitemap we have
+// detectRootElement partially unmarshals just enough to determine what kind of sitemap we have.
 func detectRootElement(raw []byte) (string, error) {
 	var detector RootDetector
 	err := xml.Unmarshal(raw, &detector)
@@ -54,3 +322,54 @@ func detectRootElement(raw []byte) (string, error) {
 	}
 	return detector.XMLName.Local, nil
 }
+
+// gzipMagic is the first two bytes of any gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// maybeGunzip decompresses `raw` if it's gzipped, and returns it untouched otherwise.
+func maybeGunzip(raw []byte) ([]byte, error) {
+	if !bytes.HasPrefix(raw, gzipMagic) {
+		return raw, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = zr.Close() }()
+	out, err := io.ReadAll(io.LimitReader(zr, MaxSitemapBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > MaxSitemapBytes {
+		return nil, ErrSitemapTooLarge
+	}
+	return out, nil
+}
+
+// isTextSitemap is true for anything that doesn't look like XML. An XML sitemap always opens with a tag,
+// possibly after a byte-order mark and some whitespace.
+func isTextSitemap(raw []byte) bool {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf")))
+	return len(trimmed) > 0 && trimmed[0] != '<'
+}
+
+// extractTextSitemap parses the protocol's text format: one absolute URL per line, and nothing else.
+func extractTextSitemap(raw []byte) ([]SitemapEntry, error) {
+	var entries []SitemapEntry
+	sc := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || !u.IsAbs() {
+			return nil, fmt.Errorf("%w: '%s'", ErrInvalidTextSitemap, line)
+		}
+		entries = append(entries, SitemapEntry{Loc: *u})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("error reading text sitemap: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,199 @@
+package autoklept
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseSitemapURLsIndex(t *testing.T) {
+	var srvURL string
+	pages := map[string]string{
+		// The nested index points back at the root, which must not loop forever.
+		"/sitemap.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%[1]s/posts.xml</loc></sitemap>
+  <sitemap><loc>%[1]s/nested.xml</loc></sitemap>
+</sitemapindex>`,
+		"/nested.xml": `<sitemapindex><sitemap><loc>%[1]s/pages.xml</loc></sitemap><sitemap><loc>%[1]s/sitemap.xml</loc></sitemap></sitemapindex>`,
+		"/posts.xml":  `<urlset><url><loc>%[1]s/a</loc></url><url><loc>%[1]s/b</loc></url></urlset>`,
+		"/pages.xml":  `<urlset><url><loc>%[1]s/b</loc></url><url><loc>%[1]s/c</loc></url></urlset>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = fmt.Fprintf(w, body, srvURL)
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	urls, err := ParseSitemapURLs(context.Background(), srv.URL+"/sitemap.xml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{srv.URL + "/a", srv.URL + "/b", srv.URL + "/c"}
+	if len(urls) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, urls)
+	}
+	for i, u := range urls {
+		if u.String() != expected[i] {
+			t.Errorf("expected %s at %d, got %s", expected[i], i, u.String())
+		}
+	}
+}
+
+func TestParseSitemapURLsTooDeep(t *testing.T) {
+	var srvURL string
+	// Every level points at a brand-new level, so only the depth limit stops us.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s%s/x</loc></sitemap></sitemapindex>`, srvURL, r.URL.Path)
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	if _, err := ParseSitemapURLs(context.Background(), srv.URL+"/x"); !errors.Is(err, ErrSitemapTooDeep) {
+		t.Errorf("expected %v, got %v", ErrSitemapTooDeep, err)
+	}
+}
+
+func TestExtractUrlSetMetadata(t *testing.T) {
+	raw := []byte(`<urlset>
+  <url><loc> https://example.com/a </loc><lastmod>2024-03-05T10:15:00+00:00</lastmod><changefreq>weekly</changefreq><priority>0.8</priority></url>
+  <url><loc>https://example.com/b</loc><lastmod>2023-11-02</lastmod></url>
+  <url><loc>https://example.com/c</loc><lastmod>last tuesday</lastmod></url>
+</urlset>`)
+	entries, err := extractUrlSet(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	a := entries[0]
+	if a.Loc.String() != "https://example.com/a" || a.ChangeFreq != "weekly" || a.Priority != 0.8 {
+		t.Errorf("unexpected entry %+v", a)
+	}
+	if !a.LastMod.Equal(time.Date(2024, 3, 5, 10, 15, 0, 0, time.UTC)) {
+		t.Errorf("unexpected lastmod %v", a.LastMod)
+	}
+	if !entries[1].LastMod.Equal(time.Date(2023, 11, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected lastmod %v", entries[1].LastMod)
+	}
+	if !entries[2].LastMod.IsZero() {
+		t.Errorf("expected zero lastmod for garbage input, got %v", entries[2].LastMod)
+	}
+}
+
+func TestParseSitemapURLsFormats(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte(`<urlset><url><loc>https://example.com/gz</loc></url></urlset>`))
+	_ = zw.Close()
+
+	pages := map[string][]byte{
+		"/sitemap.xml.gz": gz.Bytes(),
+		"/sitemap.txt":    []byte("\xef\xbb\xbfhttps://example.com/one\n\nhttps://example.com/two\r\n"),
+		"/bad.txt":        []byte("https://example.com/one\nnot a url\n"),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Deliberately unhelpful, like plenty of real servers.
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(pages[r.URL.Path])
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name        string
+		path        string
+		expected    []string
+		expectedErr error
+	}{
+		{name: "gzip", path: "/sitemap.xml.gz", expected: []string{"https://example.com/gz"}},
+		{name: "text", path: "/sitemap.txt", expected: []string{"https://example.com/one", "https://example.com/two"}},
+		{name: "bad text", path: "/bad.txt", expectedErr: ErrInvalidTextSitemap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urls, err := ParseSitemapURLs(context.Background(), srv.URL+tt.path)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("expected err %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(urls) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, urls)
+			}
+			for i, u := range urls {
+				if u.String() != tt.expected[i] {
+					t.Errorf("expected %s, got %s", tt.expected[i], u.String())
+				}
+			}
+		})
+	}
+}
+
+func TestParseSitemapEntriesStaleChildren(t *testing.T) {
+	tests := []struct {
+		name            string
+		index           string
+		expectedLocs    int
+		expectedSkipped int // -1 when the whole thing should fail.
+	}{
+		{
+			name:            "one stale child",
+			index:           `<sitemapindex><sitemap><loc>https://example.com/posts.xml</loc></sitemap><sitemap><loc>https://example.com/gone.xml</loc></sitemap></sitemapindex>`,
+			expectedLocs:    2,
+			expectedSkipped: 1,
+		},
+		{
+			name:            "every child stale",
+			index:           `<sitemapindex><sitemap><loc>https://example.com/gone.xml</loc></sitemap><sitemap><loc>https://example.com/also-gone.xml</loc></sitemap></sitemapindex>`,
+			expectedSkipped: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := mapFetcher{
+				"https://example.com/sitemap.xml": tt.index,
+				"https://example.com/posts.xml":   `<urlset><url><loc>https://example.com/a</loc></url><url><loc>https://example.com/b</loc></url></urlset>`,
+			}
+			entries, err := parseSitemapEntries(context.Background(), f, "https://example.com/sitemap.xml")
+			var sce *SitemapChildrenError
+			if tt.expectedSkipped < 0 {
+				if entries != nil || err == nil || errors.As(err, &sce) {
+					t.Errorf("expected a plain error and no entries, got %v, %v", entries, err)
+				}
+				return
+			}
+			if !errors.As(err, &sce) || len(sce.Errs) != tt.expectedSkipped || !errors.Is(err, ErrNon200ResponseCode) {
+				t.Errorf("expected %d skipped child(ren), got %v", tt.expectedSkipped, err)
+			}
+			if len(entries) != tt.expectedLocs {
+				t.Errorf("expected %d entries, got %v", tt.expectedLocs, entries)
+			}
+		})
+	}
+}
+
+func TestSitemapWalkCancelledWhileQueued(t *testing.T) {
+	w := &sitemapWalker{fetcher: mapFetcher{}, fetches: make(chan struct{}, 1), seen: map[string]bool{}}
+	w.fetches <- struct{}{} // Every fetch slot is taken.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := w.walk(ctx, "https://example.com/sitemap.xml", 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
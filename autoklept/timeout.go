@@ -0,0 +1,38 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultChatTimeout is generous, since big pages on slow models really can take minutes.
+	DefaultChatTimeout = 300 * time.Second
+	// DefaultFetchTimeout is per attempt, for pages, sitemaps and feeds alike.
+	DefaultFetchTimeout = 30 * time.Second
+)
+
+// Each stage times out with its own error, so you can tell a slow site from a slow LLM.
+var (
+	ErrFetchTimeout = errors.New("fetch timed out")
+	ErrChatTimeout  = errors.New("chat completion timed out")
+	ErrURLTimeout   = errors.New("extraction timed out")
+)
+
+// withDeadline runs `fn` under a `d` deadline, and labels the error with `cause` if that's what stopped it.
+// If the parent context gave up first, that's somebody else's timeout, and the error is left alone.
+// A zero `d` means no deadline.
+func withDeadline[T any](ctx context.Context, d time.Duration, cause error, fn func(context.Context) (T, error)) (T, error) {
+	if d <= 0 {
+		return fn(ctx)
+	}
+	dctx, cancel := context.WithTimeoutCause(ctx, d, cause)
+	defer cancel()
+	v, err := fn(dctx)
+	if err != nil && ctx.Err() == nil && errors.Is(context.Cause(dctx), cause) {
+		err = fmt.Errorf("%w after %v: %w", cause, d, err)
+	}
+	return v, err
+}
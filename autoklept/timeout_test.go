@@ -0,0 +1,93 @@
+package autoklept
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// slowProvider blocks until the context gives up.
+type slowProvider struct{}
+
+func (slowProvider) CreateChatCompletion(ctx context.Context, _ *ChatRequest) (*ChatResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestExecPromptForTimeouts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		_, _ = w.Write([]byte(`<html><body><p>hello</p></body></html>`))
+	}))
+	defer srv.Close()
+
+	noRetry := WithRetry(RetryPolicy{MaxAttempts: 1})
+	tests := []struct {
+		name        string
+		path        string
+		opts        []ClientOption
+		expectedErr error
+		notErr      error
+	}{
+		{name: "fetch", path: "/slow", opts: []ClientOption{noRetry, WithFetchTimeout(20 * time.Millisecond)}, expectedErr: ErrFetchTimeout, notErr: ErrChatTimeout},
+		{name: "chat", opts: []ClientOption{noRetry, WithTimeout(20 * time.Millisecond)}, expectedErr: ErrChatTimeout, notErr: ErrFetchTimeout},
+		{
+			name:        "whole URL",
+			opts:        []ClientOption{WithRetry(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}), WithTimeout(20 * time.Millisecond), WithURLTimeout(50 * time.Millisecond)},
+			expectedErr: ErrURLTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient("", append([]ClientOption{WithProvider(slowProvider{})}, tt.opts...)...)
+			pr, err := c.NewPromptRequest(context.Background(), &PromptRequestInput{InputTag: "blog", OutputTag: "markdown"})
+			if err != nil {
+				t.Fatalf("unexpected error building prompt request: %v", err)
+			}
+			_, err = c.ExecPromptFor(context.Background(), pr, srv.URL+tt.path)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected %v, got %v", tt.expectedErr, err)
+			}
+			if tt.notErr != nil && errors.Is(err, tt.notErr) {
+				t.Errorf("expected only %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestChatTimeoutOutlastsLibraryDefault(t *testing.T) {
+	// deepseek-go would otherwise give up at DEEPSEEK_TIMEOUT, well before our own deadline.
+	t.Setenv("DEEPSEEK_TIMEOUT", "20ms")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			_, _ = w.Write([]byte(`<html><body><p>hello</p></body></html>`))
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"cmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],"usage":{"total_tokens":7}}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewOpenAIProvider(OpenAIConfig{BaseURL: srv.URL + "/v1", Model: "qwen"})
+	if err != nil {
+		t.Fatalf("unexpected error building provider: %v", err)
+	}
+	c := NewClient("", WithProvider(p), WithRetry(RetryPolicy{MaxAttempts: 1}), WithRobotsTxt(false), WithTimeout(5*time.Second))
+	pr, err := c.NewPromptRequest(context.Background(), &PromptRequestInput{InputTag: "blog", OutputTag: "markdown"})
+	if err != nil {
+		t.Fatalf("unexpected error building prompt request: %v", err)
+	}
+	if _, err := c.ExecPromptFor(context.Background(), pr, srv.URL+"/post"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
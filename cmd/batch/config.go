@@ -14,7 +14,15 @@ const (
 )
 
 var (
-	ErrSourceRequired = errors.New("at least one data source is required")
+	ErrSourceRequired  = errors.New("at least one data source is required")
+	ErrAPIKeyRequired  = errors.New("a DeepSeek API key is required for the deepseek provider")
+	ErrUnknownProvider = errors.New("unknown LLM provider")
+)
+
+const (
+	ProviderDeepseek = "deepseek"
+	ProviderOllama   = "ollama"
+	ProviderOpenAI   = "openai"
 )
 
 type Config struct {
@@ -30,14 +38,144 @@ func (c Config) ToAutokleptConfig() *autoklept.Config {
 	return &autoklept.Config{
 		DeepseekAPIKey:  c.Client.DeepseekAPIKey,
 		DeepseekTimeout: c.Client.DeepseekTimeout,
+		FetchTimeout:    c.Client.FetchTimeout,
+		URLTimeout:      c.Client.URLTimeout,
 	}
 }
 
 type ClientConfig struct {
+	Provider string `conf:"default:deepseek,help:The LLM backend to extract with (deepseek / ollama / openai)"`
 	// Generate and monitor usage at https://platform.deepseek.com/usage.
-	DeepseekAPIKey string `conf:"required,help:The Deepseek API Key to use for extracting content"`
+	DeepseekAPIKey string `conf:"help:The Deepseek API Key to use for extracting content (required for the deepseek provider)"`
 	// Insanely high timeout - LLM calls can take awhile!
-	DeepseekTimeout time.Duration `conf:"default:300s,help:Request timeout"`
+	DeepseekTimeout time.Duration `conf:"default:300s,help:Timeout for each LLM call attempt"`
+	FetchTimeout    time.Duration `conf:"default:30s,help:Timeout for each attempt at fetching a page / sitemap or feed"`
+	// URLTimeout covers retries, chunks and continuations too, so it needs to be a good deal bigger than the others.
+	URLTimeout time.Duration `conf:"default:0s,help:Timeout for everything it takes to extract one URL; 0 means no limit"`
+	Ollama     OllamaConfig  `conf:"help:Config for a local Ollama backend"`
+	// Named Openai rather than OpenAI so the flags come out as --client-openai-* instead of --client-open-ai-*.
+	Openai OpenAIConfig `conf:"help:Config for any OpenAI-compatible chat-completions endpoint"`
+	Fetch  FetchConfig  `conf:"help:How pages / sitemaps and feeds are fetched"`
+	Retry  RetryConfig  `conf:"help:How to retry transient failures at each stage"`
+	Limit  LimitConfig  `conf:"help:Rate limits for fetching and for the LLM"`
+}
+
+type LimitConfig struct {
+	Host HostRateLimit `conf:"help:Politeness towards each site we fetch from"`
+	Chat ChatRateLimit `conf:"help:Throttling for LLM calls"`
+}
+
+// HostRateLimit defaults to polite, since firing every job at one origin has gotten us banned before.
+type HostRateLimit struct {
+	RequestsPerSecond float64       `conf:"default:1,help:Most requests per second to any one host; 0 is unlimited"`
+	MaxConcurrent     int           `conf:"default:2,help:Most requests in flight to any one host; 0 is unlimited"`
+	CrawlDelay        time.Duration `conf:"default:0s,help:Least time between requests to any one host"`
+}
+
+type ChatRateLimit struct {
+	RequestsPerSecond float64 `conf:"default:0,help:Most LLM calls per second; 0 is unlimited"`
+	MaxConcurrent     int     `conf:"default:0,help:Most LLM calls in flight; 0 is unlimited"`
+}
+
+type RetryConfig struct {
+	Page    RetryPolicy `conf:"help:Retries for fetching pages to extract"`
+	Sitemap RetryPolicy `conf:"help:Retries for fetching sitemaps / feeds / robots.txt and crawled pages"`
+	Chat    RetryPolicy `conf:"help:Retries for LLM chat completions"`
+}
+
+type RetryPolicy struct {
+	MaxAttempts int           `conf:"default:3,help:Attempts including the first; 1 never retries"`
+	BaseDelay   time.Duration `conf:"default:1s,help:Wait before the first retry; doubles for each one after"`
+	MaxDelay    time.Duration `conf:"default:30s,help:Longest wait between attempts; a longer Retry-After gives up"`
+	Jitter      float64       `conf:"default:0.5,help:Fraction of each wait that's randomised"`
+}
+
+func (p RetryPolicy) toAutoklept() autoklept.RetryPolicy {
+	return autoklept.RetryPolicy{
+		MaxAttempts: p.MaxAttempts,
+		BaseDelay:   p.BaseDelay,
+		MaxDelay:    p.MaxDelay,
+		Jitter:      p.Jitter,
+	}
+}
+
+type FetchConfig struct {
+	UserAgent    string   `conf:"help:User-Agent to fetch with; empty uses autoklept's default"`
+	Headers      []string `conf:"help:Extra request headers as Key: Value"`
+	MaxBodyBytes int64    `conf:"help:Fail any response bigger than this; 0 uses autoklept's default"`
+	IgnoreRobots bool     `conf:"default:false,help:Fetch pages even when the site's robots.txt disallows them"`
+}
+
+type OpenAIConfig struct {
+	BaseURL string `conf:"help:The endpoint base URL up to but excluding chat/completions (e.g. http://localhost:8000/v1)"`
+	Model   string `conf:"help:The model name to request"`
+	APIKey  string `conf:"mask,help:Bearer token for the endpoint if it needs one"`
+}
+
+type OllamaConfig struct {
+	Host          string `conf:"default:http://localhost:11434,help:The Ollama server to send extractions to"`
+	Model         string `conf:"help:The Ollama model to extract with (e.g. llama3.1:8b)"`
+	ContextLength int    `conf:"help:Override the model's context window (num_ctx); 0 keeps the model default"`
+}
+
+// ClientOptions translates the configured provider into options for autoklept.NewClient.
+func (c ClientConfig) ClientOptions() ([]autoklept.ClientOption, error) {
+	header, err := autoklept.ParseHeader(c.Fetch.Headers)
+	if err != nil {
+		return nil, err
+	}
+	opts := []autoklept.ClientOption{
+		autoklept.WithTimeout(c.DeepseekTimeout),
+		autoklept.WithFetchTimeout(c.FetchTimeout),
+		autoklept.WithURLTimeout(c.URLTimeout),
+		autoklept.WithFetcher(autoklept.NewHTTPFetcher(autoklept.FetcherConfig{
+			Header:       header,
+			UserAgent:    c.Fetch.UserAgent,
+			MaxBodyBytes: c.Fetch.MaxBodyBytes,
+		})),
+		autoklept.WithRobotsTxt(!c.Fetch.IgnoreRobots),
+		autoklept.WithPageRetry(c.Retry.Page.toAutoklept()),
+		autoklept.WithSitemapRetry(c.Retry.Sitemap.toAutoklept()),
+		autoklept.WithChatRetry(c.Retry.Chat.toAutoklept()),
+		autoklept.WithHostRateLimit(autoklept.HostRateLimit{
+			RequestsPerSecond: c.Limit.Host.RequestsPerSecond,
+			MaxConcurrent:     c.Limit.Host.MaxConcurrent,
+			CrawlDelay:        c.Limit.Host.CrawlDelay,
+		}),
+		autoklept.WithChatRateLimit(autoklept.ChatRateLimit{
+			RequestsPerSecond: c.Limit.Chat.RequestsPerSecond,
+			MaxConcurrent:     c.Limit.Chat.MaxConcurrent,
+		}),
+	}
+	switch c.Provider {
+	case ProviderDeepseek:
+		if c.DeepseekAPIKey == "" {
+			return nil, ErrAPIKeyRequired
+		}
+	case ProviderOllama:
+		p, err := autoklept.NewOllamaProvider(autoklept.OllamaConfig{
+			Host:          c.Ollama.Host,
+			Model:         c.Ollama.Model,
+			ContextLength: c.Ollama.ContextLength,
+		})
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, autoklept.WithProvider(p))
+	case ProviderOpenAI:
+		p, err := autoklept.NewOpenAIProvider(autoklept.OpenAIConfig{
+			BaseURL: c.Openai.BaseURL,
+			Model:   c.Openai.Model,
+			APIKey:  c.Openai.APIKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, autoklept.WithProvider(p))
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, c.Provider)
+	}
+	return opts, nil
 }
 
 func ParseConfig() (*Config, error) {
@@ -55,10 +193,23 @@ func ParseConfig() (*Config, error) {
 type PromptOpts struct {
 	InputContentTag  string `conf:"required,help:The type of content to extract"`
 	OutputContentTag string `conf:"required,help:The content output format"`
+	// MaxInputTokens splits pages bigger than this into chunks that are extracted separately. DeepSeek's context is 64K.
+	MaxInputTokens int `conf:"default:0,help:Split pages over this many estimated tokens into chunks; 0 never splits"`
+	// MaxContinuations is how many times to ask the LLM to keep going when it stops at its output token limit.
+	MaxContinuations int `conf:"default:3,help:How many times to ask the LLM to continue truncated output; -1 never continues"`
 }
 
 type HTMLOpts struct {
 	NodeFinder NodeFinder `conf:"help:How to access a subtree of your input content's HTML for parsing"`
+	// Selector is the more expressive alternative to NodeFinder. Set one or the other.
+	Selector string `conf:"help:CSS selector for the subtree of your input content's HTML to parse (e.g. article.post > div.entry-content)"`
+	// Exclude is comma-separated, so each entry must be a single selector rather than a selector list.
+	Exclude []string `conf:"help:CSS selector(s) for boilerplate to strip out of the content before prompting such as .share-buttons and #comments"`
+	Clean   string   `conf:"default:none,help:How hard to scrub HTML before prompting to save tokens (none / light / aggressive)"`
+	// FallbackSelectors and OnNotFound keep one changed page template from failing a whole batch.
+	FallbackSelectors []string `conf:"help:CSS selector(s) to try in order when NodeFinder / Selector matches nothing"`
+	OnNotFound        string   `conf:"default:fail,help:What to do when nothing matches at all (fail / document)"`
+	MatchAll          bool     `conf:"help:Send every node the finder matches in document order instead of just the first"`
 }
 
 type NodeFinder struct {
@@ -68,10 +219,48 @@ type NodeFinder struct {
 }
 
 type SourceOpts struct {
-	Urls        []string `conf:"help:URL(s) to fetch"`
-	SitemapUrls []string `conf:"help:XML Sitemap(s) to parse for extracting user content"`
+	Urls        []string   `conf:"help:URL(s) to fetch"`
+	SitemapUrls []string   `conf:"help:XML Sitemap(s) to parse for extracting user content"`
+	Sites       []string   `conf:"help:Site root(s) whose sitemaps are found via robots.txt and well-known paths"`
+	FeedUrls    []string   `conf:"help:RSS or Atom feed(s) whose entries to extract"`
+	Crawl       CrawlOpts  `conf:"help:Find pages by following links for sites with no sitemap or feed"`
+	Filter      FilterOpts `conf:"help:Which sitemap / feed and crawled URLs to extract; listed URLs are always extracted"`
+}
+
+// FilterOpts is autoklept.URLFilterConfig, with the dates as strings for the sake of flags.
+type FilterOpts struct {
+	Include []string `conf:"help:Only extract URLs matching one of these regexps; glob:/blog/* style globs match the path"`
+	Exclude []string `conf:"help:Never extract URLs matching any of these regexps or globs"`
+	Since   string   `conf:"help:Only extract URLs last modified on or after this date (YYYY-MM-DD); undated URLs are dropped"`
+	Until   string   `conf:"help:Only extract URLs last modified before this date (YYYY-MM-DD); undated URLs are dropped"`
+}
+
+func (f FilterOpts) toAutoklept() (autoklept.URLFilterConfig, error) {
+	cfg := autoklept.URLFilterConfig{Include: f.Include, Exclude: f.Exclude}
+	var err error
+	if f.Since != "" {
+		if cfg.Since, err = time.Parse(time.DateOnly, f.Since); err != nil {
+			return cfg, fmt.Errorf("error parsing since date: %w", err)
+		}
+	}
+	if f.Until != "" {
+		if cfg.Until, err = time.Parse(time.DateOnly, f.Until); err != nil {
+			return cfg, fmt.Errorf("error parsing until date: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+type CrawlOpts struct {
+	Seeds    []string `conf:"help:URL(s) to start crawling from; only links to the same host are followed"`
+	MaxDepth int      `conf:"default:3,help:How many links to follow away from a seed; -1 takes only the seeds"`
+	MaxPages int      `conf:"default:500,help:Most pages to fetch over the whole crawl"`
+	Include  []string `conf:"help:Regexp(s) or glob(s) a crawled URL must match to be extracted; pages that don't are still followed"`
+	Exclude  []string `conf:"help:Regexp(s) or glob(s) for URLs to neither extract nor follow"`
 }
 
 type OutputConfig struct {
 	FilePrefix string `conf:"default:autoklept,help:The file name prefix for autoklept parsed output content"`
+	// Only sitemap URLs with a lastmod and feed entries with a date can be skipped - anything else is always re-extracted.
+	StateFile string `conf:"help:JSON file recording what was extracted when; if set then reruns skip sitemap / feed pages whose lastmod or feed date hasn't moved"`
 }
@@ -4,95 +4,205 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
 	"os"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/jmontroy90/autoklept/autoklept"
 	"github.com/pelletier/go-toml"
 )
 
+var (
+	// errWriteOutput is the one per-URL failure that stops the batch, since it'll only fail again for the next URL.
+	errWriteOutput = errors.New("error writing output")
+)
+
 func main() {
 	cfg, err := ParseConfig()
 	if err != nil {
 		log.Fatalf("error parsing config: %v", err)
 	}
 	ctx := context.Background()
-	client := autoklept.NewClient(cfg.Client.DeepseekAPIKey, autoklept.WithTimeout(cfg.Client.DeepseekTimeout))
-	urls, err := buildURLs(ctx, cfg.Source.Urls, cfg.Source.SitemapUrls)
+	opts, err := cfg.Client.ClientOptions()
+	if err != nil {
+		log.Fatalf("error configuring client: %v", err)
+	}
+	client := autoklept.NewClient(cfg.Client.DeepseekAPIKey, opts...)
+	urls, err := buildURLs(ctx, client, cfg.Source)
 	if err != nil {
 		log.Fatalf("%v", err)
 	}
+	st, err := loadBatchState(cfg.Output.StateFile)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	urls = filterUnchanged(urls, st)
+	urls = filterDisallowed(ctx, client, urls)
+	// One request drives the whole batch - only the page HTML differs between URLs.
+	pr, err := client.NewPromptRequest(ctx, buildPromptRequestInput(*cfg))
+	if err != nil {
+		log.Fatalf("error building prompt request: %v", err)
+	}
 	if cfg.NumJobs == 1 {
-		if err := processSequential(ctx, client, *cfg, urls); err != nil {
+		if err := processSequential(ctx, client, pr, *cfg, st, urls); err != nil {
 			log.Fatalf("%v", err)
 		}
 	} else {
-		if err := processParallel(ctx, client, *cfg, urls); err != nil {
+		if err := processParallel(ctx, client, pr, *cfg, st, urls); err != nil {
 			log.Fatalf("%v", err)
 		}
 	}
 }
 
-func processSequential(ctx context.Context, client *autoklept.Client, cfg Config, urls []string) error {
+// sourceURL is a URL to extract, plus its sitemap lastmod or feed date if we have one.
+type sourceURL struct {
+	Loc     string
+	LastMod time.Time
+	Feed    *autoklept.FeedEntry // Set if the URL came from a feed, to seed Hugo front matter.
+}
+
+func filterUnchanged(urls []sourceURL, st *batchState) []sourceURL {
+	var changed []sourceURL
 	for _, u := range urls {
-		if err := processURL(ctx, client, cfg, u); err != nil {
-			return fmt.Errorf("error processing url '%s': %w", u, err)
+		if st.needsExtraction(u) {
+			changed = append(changed, u)
+		}
+	}
+	if skipped := len(urls) - len(changed); skipped > 0 {
+		log.Printf("skipping %d URL(s) unchanged since the last run\n", skipped)
+	}
+	return changed
+}
+
+// filterDisallowed drops the URLs robots.txt won't let us have, up front, so they're reported as skipped rather than
+// failing one by one. A robots.txt we can't check is left for ExecPromptFor to deal with.
+func filterDisallowed(ctx context.Context, client *autoklept.Client, urls []sourceURL) []sourceURL {
+	var allowed []sourceURL
+	for _, u := range urls {
+		ok, err := client.RobotsAllowed(ctx, u.Loc)
+		if err == nil && !ok {
+			log.Printf("SKIPPING URL (robots.txt): '%s'\n", u.Loc)
+			continue
+		}
+		allowed = append(allowed, u)
+	}
+	if skipped := len(urls) - len(allowed); skipped > 0 {
+		log.Printf("skipping %d URL(s) disallowed by robots.txt\n", skipped)
+	}
+	return allowed
+}
+
+func processSequential(ctx context.Context, client *autoklept.Client, pr *autoklept.PromptRequest, cfg Config, st *batchState, urls []sourceURL) error {
+	for _, u := range urls {
+		if err := processOne(ctx, client, pr, cfg, st, u); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func processParallel(ctx context.Context, client *autoklept.Client, cfg Config, urls []string) error {
-	var wg sync.WaitGroup
-	uChan := make(chan string)
+// processParallel stops handing out URLs on the first error that stops the batch, same as processSequential.
+func processParallel(ctx context.Context, client *autoklept.Client, pr *autoklept.PromptRequest, cfg Config, st *batchState, urls []sourceURL) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	uChan := make(chan sourceURL)
 	for i := 0; i < cfg.NumJobs; i++ {
 		wg.Add(1)
-		go func(cu <-chan string, w *sync.WaitGroup) {
+		go func(cu <-chan sourceURL, w *sync.WaitGroup) {
 			defer w.Done()
 			for u := range cu {
-				if err := processURL(ctx, client, cfg, u); err != nil {
-					// TODO: errgroup?
-					log.Printf("FAILED PROCESSING URL: '%s': %v\n", u, err)
+				if err := processOne(ctx, client, pr, cfg, st, u); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
 				}
 			}
 		}(uChan, &wg)
 	}
+feed:
 	for _, u := range urls {
-		uChan <- u
+		select {
+		case uChan <- u:
+		case <-ctx.Done():
+			break feed
+		}
 	}
 	close(uChan)
 	wg.Wait()
+	return firstErr
+}
+
+// processOne extracts `u` and records it as done, only returning an error if it should stop the batch.
+// Anything to do with the page - fetching it, the LLM's take on it, the output it made - is logged and skipped, so one
+// bad page doesn't cost the rest of the batch. Only our own I/O failing, which would fail for every URL after it,
+// stops the batch.
+func processOne(ctx context.Context, client *autoklept.Client, pr *autoklept.PromptRequest, cfg Config, st *batchState, u sourceURL) error {
+	partial, err := processURL(ctx, client, pr, cfg, u)
+	switch {
+	case errors.Is(err, autoklept.ErrDisallowedByRobots):
+		log.Printf("SKIPPING URL (robots.txt): '%s'\n", u.Loc)
+		return nil
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case errors.Is(err, errWriteOutput):
+		return fmt.Errorf("error processing url '%s': %w", u.Loc, err)
+	case err != nil:
+		log.Printf("SKIPPING URL: '%s': %v\n", u.Loc, err)
+		return nil
+	case partial:
+		// Partial output is still written, but not recorded, so the next run has another go at it.
+		return nil
+	}
+	if err := st.record(u); err != nil {
+		return fmt.Errorf("error recording state for url '%s': %w", u.Loc, err)
+	}
 	return nil
 }
 
-func processURL(ctx context.Context, client *autoklept.Client, cfg Config, u string) error {
-	req, err := client.NewPromptRequest(ctx, buildPromptRequestInput(cfg))
+// processURL extracts and writes out a single page, reporting whether the output was left truncated.
+func processURL(ctx context.Context, client *autoklept.Client, pr *autoklept.PromptRequest, cfg Config, u sourceURL) (bool, error) {
+	resp, err := client.ExecPromptFor(ctx, pr, u.Loc)
 	if err != nil {
-		return err
+		return false, err
 	}
-	resp, err := client.ExecPromptFor(ctx, req, u)
-	if err != nil {
-		return err
+	log.Printf("extracted '%s': %d page bytes, %d -> %d HTML bytes cleaned, %d tokens over %d chunk(s), %d continuation(s), %d fetch / %d chat attempt(s)\n",
+		u.Loc, resp.PageBytes, resp.HTMLBytesBefore, resp.HTMLBytesAfter, resp.TokensUsed, resp.Chunks, resp.Continuations, resp.FetchAttempts, resp.ChatAttempts)
+	if resp.Partial {
+		log.Printf("PARTIAL OUTPUT FOR URL: '%s': still truncated (finish reason %q) after %d continuation(s)\n", u.Loc, resp.FinishReason, resp.Continuations)
 	}
+	content := resp.Content
 	// TODO: there's like a whole "parsers" thingy implied by this lol
 	// TODO: Probably need to try to strip out bad output formatting if the LLM decides to go rogue over time,
 	// but there's only so much to really try to do here.
-	outFile := fmt.Sprintf("%s-%s.md", cfg.Output.FilePrefix, hashPrefix(u, 5))
+	outFile := fmt.Sprintf("%s-%s.md", cfg.Output.FilePrefix, hashPrefix(u.Loc, 5))
 	if strings.ToLower(cfg.Prompt.OutputContentTag) == strings.ToLower(autoklept.PromptOutputHugo.String()) {
-		fm, err := parseTOMLFrontMatter(resp.Content)
+		if u.Feed != nil {
+			if content, err = seedTOMLFrontMatter(content, u.Feed); err != nil {
+				return false, err
+			}
+		}
+		fm, err := parseTOMLFrontMatter(content)
 		if err != nil {
-			return err
+			return false, err
 		}
 		outFile = fmt.Sprintf("%s.md", cleanTitle(fm.Title))
 	}
-	if err := os.WriteFile(fmt.Sprintf("out/%s", outFile), []byte(resp.Content), 0644); err != nil {
-		return err
+	if err := os.WriteFile(fmt.Sprintf("out/%s", outFile), []byte(content), 0644); err != nil {
+		return false, fmt.Errorf("%w: %w", errWriteOutput, err)
 	}
-	return nil
+	return resp.Partial, nil
 }
 
 func cleanTitle(t string) string {
@@ -113,28 +223,103 @@ func buildPromptRequestInput(cfg Config) *autoklept.PromptRequestInput {
 	}
 	// TODO: translation layers are interesting.
 	return &autoklept.PromptRequestInput{
-		InputTag:   cfg.Prompt.InputContentTag,
-		OutputTag:  cfg.Prompt.OutputContentTag,
-		HTMLFinder: htmlFinder,
+		InputTag:              cfg.Prompt.InputContentTag,
+		OutputTag:             cfg.Prompt.OutputContentTag,
+		HTMLFinder:            htmlFinder,
+		HTMLSelector:          cfg.Html.Selector,
+		HTMLExclude:           cfg.Html.Exclude,
+		CleanLevel:            cfg.Html.Clean,
+		HTMLFallbackSelectors: cfg.Html.FallbackSelectors,
+		OnNotFound:            cfg.Html.OnNotFound,
+		HTMLMatchAll:          cfg.Html.MatchAll,
+		MaxInputTokens:        cfg.Prompt.MaxInputTokens,
+		MaxContinuations:      cfg.Prompt.MaxContinuations,
 	}
 }
 
-func buildURLs(ctx context.Context, sourceURLs, sitemapURLs []string) ([]string, error) {
-	var urls []string
-	for _, uStr := range sourceURLs {
+func buildURLs(ctx context.Context, client *autoklept.Client, src SourceOpts) ([]sourceURL, error) {
+	var urls []sourceURL
+	for _, uStr := range src.Urls {
 		u, err := url.Parse(uStr)
 		if err != nil {
 			return nil, fmt.Errorf("error parsing source URL: %w", err)
 		}
-		urls = append(urls, u.String())
+		urls = append(urls, sourceURL{Loc: u.String()})
 	}
-	for _, smUrl := range sitemapURLs {
-		found, err := autoklept.ParseSitemapURLs(ctx, smUrl)
+	fc, err := src.Filter.toAutoklept()
+	if err != nil {
+		return nil, err
+	}
+	filter, err := autoklept.NewURLFilter(fc)
+	if err != nil {
+		return nil, err
+	}
+	discovered, err := discoverURLs(ctx, client, src)
+	if err != nil {
+		return nil, err
+	}
+	// Listed URLs were asked for by name, so only what we found for ourselves is filtered.
+	for _, su := range discovered {
+		u, err := url.Parse(su.Loc)
+		if err == nil && filter.Keep(u, su.LastMod) {
+			urls = append(urls, su)
+		}
+	}
+	if dropped := len(src.Urls) + len(discovered) - len(urls); dropped > 0 {
+		log.Printf("filtered out %d discovered URL(s)\n", dropped)
+	}
+	return urls, nil
+}
+
+// discoverURLs gathers the URLs from every sitemap, feed and crawl source.
+func discoverURLs(ctx context.Context, client *autoklept.Client, src SourceOpts) ([]sourceURL, error) {
+	var urls []sourceURL
+	sitemapURLs := slices.Clone(src.SitemapUrls)
+	for _, site := range src.Sites {
+		found, err := client.DiscoverSitemaps(ctx, site)
 		if err != nil {
+			return nil, fmt.Errorf("error discovering sitemaps: %w", err)
+		}
+		sitemapURLs = append(sitemapURLs, found...)
+	}
+	for _, feedUrl := range src.FeedUrls {
+		found, err := client.ParseFeedEntries(ctx, feedUrl)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing feed URLs: %w", err)
+		}
+		for _, f := range found {
+			lastMod := f.Updated
+			if lastMod.IsZero() {
+				lastMod = f.Published
+			}
+			urls = append(urls, sourceURL{Loc: f.Link.String(), LastMod: lastMod, Feed: &f})
+		}
+	}
+	if len(src.Crawl.Seeds) > 0 {
+		found, err := client.Crawl(ctx, autoklept.CrawlConfig{
+			Seeds:    src.Crawl.Seeds,
+			MaxDepth: src.Crawl.MaxDepth,
+			MaxPages: src.Crawl.MaxPages,
+			Include:  src.Crawl.Include,
+			Exclude:  src.Crawl.Exclude,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error crawling: %w", err)
+		}
+		for _, f := range found {
+			urls = append(urls, sourceURL{Loc: f.String()})
+		}
+	}
+	for _, smUrl := range sitemapURLs {
+		found, err := client.ParseSitemapEntries(ctx, smUrl)
+		var sce *autoklept.SitemapChildrenError
+		if errors.As(err, &sce) {
+			log.Printf("WARNING: sitemap '%s': skipped %v\n", smUrl, sce)
+		} else if err != nil {
 			return nil, fmt.Errorf("error parsing sitemap URLs: %w", err)
 		}
 		for _, f := range found {
-			urls = append(urls, f.String())
+			urls = append(urls, sourceURL{Loc: f.Loc.String(), LastMod: f.LastMod})
 		}
 	}
 	return urls, nil
@@ -166,3 +351,51 @@ func parseTOMLFrontMatter(content string) (*FrontMatter, error) {
 	}
 	return &fm, nil
 }
+
+// seedTOMLFrontMatter fills in any front matter fields the LLM left empty from the page's feed entry,
+// which is generally more trustworthy than whatever the LLM dug out of the page.
+func seedTOMLFrontMatter(content string, fe *autoklept.FeedEntry) (string, error) {
+	if !strings.HasPrefix(content, "+++\n") {
+		return "", fmt.Errorf("no TOML front matter found")
+	}
+	parts := strings.SplitN(content, "+++\n", 3)
+	if len(parts) < 3 {
+		return "", fmt.Errorf("invalid TOML front matter format")
+	}
+	tree, err := toml.Load(parts[1])
+	if err != nil {
+		return "", err
+	}
+	if isEmptyTOML(tree.Get("title")) && fe.Title != "" {
+		tree.Set("title", fe.Title)
+	}
+	if isEmptyTOML(tree.Get("date")) && !fe.Published.IsZero() {
+		// As a string rather than a TOML datetime, so it round-trips through FrontMatter.Date.
+		tree.Set("date", fe.Published.Format(time.RFC3339))
+	}
+	if isEmptyTOML(tree.Get("tags")) && len(fe.Categories) > 0 {
+		tags := make([]interface{}, 0, len(fe.Categories))
+		for _, c := range fe.Categories {
+			tags = append(tags, c)
+		}
+		tree.Set("tags", tags)
+	}
+	fm, err := tree.ToTomlString()
+	if err != nil {
+		return "", err
+	}
+	return "+++\n" + fm + "+++\n" + parts[2], nil
+}
+
+func isEmptyTOML(v interface{}) bool {
+	switch tv := v.(type) {
+	case nil:
+		return true
+	case string:
+		return tv == ""
+	case []interface{}:
+		return len(tv) == 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// batchState remembers what we extracted and when, so reruns only pay for pages that changed.
+// A nil *batchState is valid and remembers nothing, i.e. every URL is always extracted.
+type batchState struct {
+	mu    sync.Mutex
+	path  string
+	Pages map[string]pageState `json:"pages"`
+}
+
+type pageState struct {
+	LastMod     time.Time `json:"lastmod,omitzero"` // The sitemap lastmod or feed date as of extraction, if there was one.
+	ExtractedAt time.Time `json:"extracted_at"`
+}
+
+// loadBatchState reads the state file at `path`, if any. A missing file is just a first run.
+func loadBatchState(path string) (*batchState, error) {
+	if path == "" {
+		return nil, nil
+	}
+	st := &batchState{path: path, Pages: map[string]pageState{}}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state file: %w", err)
+	}
+	if err := json.Unmarshal(raw, st); err != nil {
+		return nil, fmt.Errorf("error parsing state file '%s': %w", path, err)
+	}
+	if st.Pages == nil {
+		st.Pages = map[string]pageState{}
+	}
+	return st, nil
+}
+
+// needsExtraction is true unless we've extracted this URL before and the sitemap says it hasn't changed since.
+// Without a lastmod there's no way to tell, so we re-extract.
+func (s *batchState) needsExtraction(u sourceURL) bool {
+	if s == nil || u.LastMod.IsZero() {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.Pages[u.Loc]
+	return !ok || u.LastMod.After(prev.LastMod)
+}
+
+// record marks `u` as extracted and saves immediately, so a crashed batch doesn't lose its progress.
+func (s *batchState) record(u sourceURL) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Pages[u.Loc] = pageState{LastMod: u.LastMod, ExtractedAt: time.Now().UTC()}
+	return s.save()
+}
+
+// save writes to a temp file and renames it over the old state, so we never leave a half-written file behind.
+func (s *batchState) save() error {
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("error creating temp state file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(raw); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
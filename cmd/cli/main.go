@@ -2,24 +2,69 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/jmontroy90/autoklept/autoklept"
 	"github.com/urfave/cli/v3"
 	"golang.org/x/exp/slog"
 	"log"
-	"net/url"
 	"os"
 	"time"
 )
 
 const (
-	ExtractCmd         = "extract"
-	ExtractAPIKeyFlag  = "deepseek-api-key"
-	ExtractTimeoutFlag = "deepseek-timeout"
-	ExtractURLFlag     = "url"
+	ExtractCmd                  = "extract"
+	ExtractAPIKeyFlag           = "deepseek-api-key"
+	ExtractTimeoutFlag          = "deepseek-timeout"
+	ExtractFetchTimeoutFlag     = "fetch-timeout"
+	ExtractURLTimeoutFlag       = "url-timeout"
+	ExtractURLFlag              = "url"
+	ExtractFileFlag             = "file"
+	ExtractBaseURLFlag          = "base-url"
+	ExtractSelectorFlag         = "selector"
+	ExtractExcludeFlag          = "exclude"
+	ExtractCleanFlag            = "clean"
+	ExtractFallbackFlag         = "fallback-selector"
+	ExtractNotFoundFlag         = "on-not-found"
+	ExtractMatchAllFlag         = "all"
+	ExtractMaxTokensFlag        = "max-input-tokens"
+	ExtractMaxContinuationsFlag = "max-continuations"
+	ExtractMaxAttemptsFlag      = "max-attempts"
+	ExtractIgnoreRobotsFlag     = "ignore-robots"
 
-	SitemapCmd     = "sitemap"
-	SitemapURLFlag = "url"
+	ExtractProviderFlag            = "provider"
+	ExtractOllamaHostFlag          = "ollama-host"
+	ExtractOllamaModelFlag         = "ollama-model"
+	ExtractOllamaContextLengthFlag = "ollama-context-length"
+	ExtractOpenAIBaseURLFlag       = "openai-base-url"
+	ExtractOpenAIModelFlag         = "openai-model"
+	ExtractOpenAIAPIKeyFlag        = "openai-api-key"
+
+	ProviderDeepseek = "deepseek"
+	ProviderOllama   = "ollama"
+	ProviderOpenAI   = "openai"
+
+	SitemapCmd          = "sitemap"
+	SitemapURLFlag      = "url"
+	SitemapDiscoverFlag = "discover"
+	SitemapIncludeFlag  = "include"
+	SitemapExcludeFlag  = "exclude"
+	SitemapSinceFlag    = "since"
+	SitemapUntilFlag    = "until"
+
+	FeedCmd     = "feed"
+	FeedURLFlag = "url"
+
+	CrawlCmd              = "crawl"
+	CrawlSeedFlag         = "seed"
+	CrawlMaxDepthFlag     = "max-depth"
+	CrawlMaxPagesFlag     = "max-pages"
+	CrawlIncludeFlag      = "include"
+	CrawlExcludeFlag      = "exclude"
+	CrawlIgnoreRobotsFlag = "ignore-robots"
+
+	FetchUserAgentFlag = "user-agent"
+	FetchHeaderFlag    = "header"
 )
 
 type cmdRunner struct {
@@ -38,19 +83,86 @@ func (r *cmdRunner) exec(ctx context.Context) {
 		Commands: []*cli.Command{
 			{
 				Name: SitemapCmd,
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:    SitemapURLFlag,
+						Aliases: []string{"u"},
+						Usage:   "Sitemap URL",
+					},
+					&cli.StringFlag{
+						Name:  SitemapDiscoverFlag,
+						Usage: "Site root whose sitemap(s) to find via robots.txt and well-known paths, instead of --url",
+					},
+					&cli.StringSliceFlag{
+						Name:  SitemapIncludeFlag,
+						Usage: "Only list URLs matching this regexp, or glob:/blog/* style glob on the path; repeatable",
+					},
+					&cli.StringSliceFlag{
+						Name:  SitemapExcludeFlag,
+						Usage: "Never list URLs matching this regexp or glob; repeatable",
+					},
+					&cli.StringFlag{
+						Name:  SitemapSinceFlag,
+						Usage: "Only list URLs with a lastmod on or after this date (YYYY-MM-DD)",
+					},
+					&cli.StringFlag{
+						Name:  SitemapUntilFlag,
+						Usage: "Only list URLs with a lastmod before this date (YYYY-MM-DD)",
+					},
+				}, fetchFlags()...),
+				Action: r.execSitemapCmd,
+			},
+			{
+				Name:  FeedCmd,
+				Usage: "List RSS / Atom feed entries as tab-separated link, date and title",
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
-						Name:     SitemapURLFlag,
+						Name:     FeedURLFlag,
 						Aliases:  []string{"u"},
-						Usage:    "Sitemap URL",
+						Usage:    "Feed URL",
 						Required: true,
 					},
-				},
-				Action: r.execSitemapCmd,
+				}, fetchFlags()...),
+				Action: r.execFeedCmd,
+			},
+			{
+				Name:  CrawlCmd,
+				Usage: "List a site's pages by following its links from one or more seed URLs",
+				Flags: append([]cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     CrawlSeedFlag,
+						Aliases:  []string{"u"},
+						Usage:    "URL to start crawling from; only links to its host are followed; repeatable",
+						Required: true,
+					},
+					&cli.IntFlag{
+						Name:  CrawlMaxDepthFlag,
+						Usage: "How many links to follow away from a seed; -1 lists only the seeds",
+						Value: autoklept.DefaultCrawlMaxDepth,
+					},
+					&cli.IntFlag{
+						Name:  CrawlMaxPagesFlag,
+						Usage: "Most pages to fetch over the whole crawl",
+						Value: autoklept.DefaultCrawlMaxPages,
+					},
+					&cli.StringSliceFlag{
+						Name:  CrawlIncludeFlag,
+						Usage: "Regexp (or glob:/path/* glob) a URL must match to be listed; non-matching pages are still followed; repeatable",
+					},
+					&cli.StringSliceFlag{
+						Name:  CrawlExcludeFlag,
+						Usage: "Regexp or glob for URLs to neither list nor follow; repeatable",
+					},
+					&cli.BoolFlag{
+						Name:  CrawlIgnoreRobotsFlag,
+						Usage: "Crawl pages even if the site's robots.txt disallows them",
+					},
+				}, fetchFlags()...),
+				Action: r.execCrawlCmd,
 			},
 			{
 				Name: ExtractCmd,
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:  ExtractAPIKeyFlag,
 						Usage: "Deepseek API key",
@@ -59,16 +171,111 @@ func (r *cmdRunner) exec(ctx context.Context) {
 					},
 					&cli.DurationFlag{
 						Name:  ExtractTimeoutFlag,
-						Usage: "Deepseek API timeout",
-						Value: 300 * time.Second,
+						Usage: "Timeout for each LLM call attempt",
+						Value: autoklept.DefaultChatTimeout,
+					},
+					&cli.DurationFlag{
+						Name:  ExtractFetchTimeoutFlag,
+						Usage: "Timeout for each attempt at fetching the page",
+						Value: autoklept.DefaultFetchTimeout,
+					},
+					&cli.DurationFlag{
+						Name:  ExtractURLTimeoutFlag,
+						Usage: "Timeout for the whole extraction, retries and all; 0 means no limit",
 					},
 					&cli.StringFlag{
-						Name:     ExtractURLFlag,
-						Usage:    "URL from which to extract content",
-						Aliases:  []string{"u"},
-						Required: true,
+						Name:    ExtractURLFlag,
+						Usage:   "URL from which to extract content",
+						Aliases: []string{"u"},
+					},
+					&cli.StringFlag{
+						Name:    ExtractFileFlag,
+						Usage:   "HTML file from which to extract content, instead of --url; - or neither reads stdin",
+						Aliases: []string{"f"},
+					},
+					&cli.StringFlag{
+						Name:  ExtractBaseURLFlag,
+						Usage: "URL that relative links in --file or stdin are resolved against",
+					},
+					&cli.StringFlag{
+						Name:    ExtractSelectorFlag,
+						Aliases: []string{"s"},
+						Usage:   "CSS selector for the part of the page to extract from; empty sends the whole page",
+						Value:   "div#SITE_CONTAINER",
+					},
+					&cli.StringSliceFlag{
+						Name:    ExtractExcludeFlag,
+						Aliases: []string{"x"},
+						Usage:   "CSS selector for boilerplate to strip out before prompting; repeatable",
+					},
+					&cli.StringFlag{
+						Name:  ExtractCleanFlag,
+						Usage: "How hard to scrub HTML before prompting to save tokens (none, light or aggressive)",
+						Value: autoklept.CleanNone.String(),
+					},
+					&cli.StringSliceFlag{
+						Name:  ExtractFallbackFlag,
+						Usage: "CSS selector to try if --selector matches nothing; repeatable, tried in order",
 					},
-				},
+					&cli.StringFlag{
+						Name:  ExtractNotFoundFlag,
+						Usage: "What to do when no selector matches (fail or document)",
+						Value: autoklept.FallbackFail.String(),
+					},
+					&cli.BoolFlag{
+						Name:  ExtractMatchAllFlag,
+						Usage: "Extract from every element --selector matches, in document order, instead of just the first",
+					},
+					&cli.IntFlag{
+						Name:  ExtractMaxTokensFlag,
+						Usage: "Split pages bigger than this many (estimated) tokens into chunks and extract each separately; 0 never splits",
+					},
+					&cli.IntFlag{
+						Name:  ExtractMaxContinuationsFlag,
+						Usage: "How many times to ask the LLM to continue output cut off at its token limit; -1 never continues",
+						Value: autoklept.DefaultMaxContinuations,
+					},
+					&cli.BoolFlag{
+						Name:  ExtractIgnoreRobotsFlag,
+						Usage: "Fetch the page even if the site's robots.txt disallows it",
+					},
+					&cli.IntFlag{
+						Name:  ExtractMaxAttemptsFlag,
+						Usage: "Attempts at fetching the page and at each LLM call before giving up on a transient failure; 1 never retries",
+						Value: autoklept.DefaultRetryPolicy.MaxAttempts,
+					},
+					&cli.StringFlag{
+						Name:  ExtractProviderFlag,
+						Usage: "LLM backend to extract with (deepseek, ollama or openai)",
+						Value: ProviderDeepseek,
+					},
+					&cli.StringFlag{
+						Name:  ExtractOllamaHostFlag,
+						Usage: "Ollama server to extract with",
+						Value: autoklept.DefaultOllamaHost,
+					},
+					&cli.StringFlag{
+						Name:  ExtractOllamaModelFlag,
+						Usage: "Ollama model to extract with, e.g. llama3.1:8b",
+					},
+					&cli.IntFlag{
+						Name:  ExtractOllamaContextLengthFlag,
+						Usage: "Ollama context window (num_ctx) override; 0 keeps the model default",
+					},
+					&cli.StringFlag{
+						Name:  ExtractOpenAIBaseURLFlag,
+						Usage: "OpenAI-compatible endpoint base URL, e.g. http://localhost:8000/v1",
+					},
+					&cli.StringFlag{
+						Name:  ExtractOpenAIModelFlag,
+						Usage: "Model to request from the OpenAI-compatible endpoint",
+					},
+					&cli.StringFlag{
+						Name:    ExtractOpenAIAPIKeyFlag,
+						Usage:   "Bearer token for the OpenAI-compatible endpoint, if it needs one",
+						Sources: cli.EnvVars("AUTOKLEPT_OPENAI_API_KEY"),
+					},
+				}, fetchFlags()...),
 				Action: r.execExtractCmd,
 			},
 		},
@@ -80,42 +287,229 @@ func (r *cmdRunner) exec(ctx context.Context) {
 }
 
 func (r *cmdRunner) execSitemapCmd(ctx context.Context, cmd *cli.Command) error {
-	sm := cmd.String(SitemapURLFlag)
-	us, err := autoklept.ParseSitemapURLs(ctx, sm)
+	c, err := newFetchClient(cmd)
+	if err != nil {
+		return err
+	}
+	filter, err := newSitemapFilter(cmd)
+	if err != nil {
+		return err
+	}
+	sm, site := cmd.String(SitemapURLFlag), cmd.String(SitemapDiscoverFlag)
+	var sitemaps []string
+	switch {
+	case sm != "" && site != "":
+		return fmt.Errorf("only one of --%s or --%s may be given", SitemapURLFlag, SitemapDiscoverFlag)
+	case sm != "":
+		sitemaps = []string{sm}
+	case site != "":
+		if sitemaps, err = c.DiscoverSitemaps(ctx, site); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("one of --%s or --%s is required", SitemapURLFlag, SitemapDiscoverFlag)
+	}
+	for _, sm := range sitemaps {
+		entries, err := c.ParseSitemapEntries(ctx, sm)
+		var sce *autoklept.SitemapChildrenError
+		if errors.As(err, &sce) {
+			fmt.Fprintf(os.Stderr, "warning: skipped %v\n", sce)
+		} else if err != nil {
+			return err
+		}
+		for _, e := range filter.FilterSitemapEntries(entries) {
+			fmt.Printf("%v\n", &e.Loc)
+		}
+	}
+	return nil
+}
+
+func newSitemapFilter(cmd *cli.Command) (*autoklept.URLFilter, error) {
+	cfg := autoklept.URLFilterConfig{
+		Include: cmd.StringSlice(SitemapIncludeFlag),
+		Exclude: cmd.StringSlice(SitemapExcludeFlag),
+	}
+	var err error
+	if since := cmd.String(SitemapSinceFlag); since != "" {
+		if cfg.Since, err = time.Parse(time.DateOnly, since); err != nil {
+			return nil, fmt.Errorf("error parsing --%s: %w", SitemapSinceFlag, err)
+		}
+	}
+	if until := cmd.String(SitemapUntilFlag); until != "" {
+		if cfg.Until, err = time.Parse(time.DateOnly, until); err != nil {
+			return nil, fmt.Errorf("error parsing --%s: %w", SitemapUntilFlag, err)
+		}
+	}
+	return autoklept.NewURLFilter(cfg)
+}
+
+func (r *cmdRunner) execFeedCmd(ctx context.Context, cmd *cli.Command) error {
+	c, err := newFetchClient(cmd)
+	if err != nil {
+		return err
+	}
+	entries, err := c.ParseFeedEntries(ctx, cmd.String(FeedURLFlag))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		var date string
+		if !e.Published.IsZero() {
+			date = e.Published.Format(time.DateOnly)
+		}
+		fmt.Printf("%s\t%s\t%s\n", e.Link.String(), date, e.Title)
+	}
+	return nil
+}
+
+func (r *cmdRunner) execCrawlCmd(ctx context.Context, cmd *cli.Command) error {
+	c, err := newFetchClient(cmd, autoklept.WithRobotsTxt(!cmd.Bool(CrawlIgnoreRobotsFlag)))
+	if err != nil {
+		return err
+	}
+	us, err := c.Crawl(ctx, autoklept.CrawlConfig{
+		Seeds:    cmd.StringSlice(CrawlSeedFlag),
+		MaxDepth: cmd.Int(CrawlMaxDepthFlag),
+		MaxPages: cmd.Int(CrawlMaxPagesFlag),
+		Include:  cmd.StringSlice(CrawlIncludeFlag),
+		Exclude:  cmd.StringSlice(CrawlExcludeFlag),
+	})
 	if err != nil {
 		return err
 	}
 	for _, u := range us {
-		fmt.Printf("%v\n", u)
+		fmt.Printf("%v\n", &u)
 	}
 	return nil
 }
 
 func (r *cmdRunner) execExtractCmd(ctx context.Context, cmd *cli.Command) error {
-	key, timeout := cmd.String(ExtractAPIKeyFlag), cmd.Duration(ExtractTimeoutFlag)
-	if key == "" {
-		return fmt.Errorf("missing required Deepseek API Key")
-	}
-	// Set client to actually have DeepSeek (TODO: is this silly?)
-	c := autoklept.NewClient(key, autoklept.WithTimeout(timeout))
-	u := cmd.String(ExtractURLFlag)
-	target, err := url.Parse(u)
+	c, err := newExtractClient(cmd)
 	if err != nil {
 		return err
 	}
-	// TODO: configurable + HTMLFinders
-	// TODO: no elementnodefinder, use CSS selectors that user can specify, you parse, does same shit!
-	// .div[id="SITE_CONTAINER"]
-	finder := &autoklept.ElementNodeFinder{Tag: "div", AttrKey: "id", AttrVal: "SITE_CONTAINER"}
-	pri := autoklept.PromptRequestInput{InputTag: "blog", OutputTag: "markdown", HTMLFinder: finder}
+	// TODO: configurable input / output tags
+	pri := autoklept.PromptRequestInput{
+		InputTag:              "blog",
+		OutputTag:             "markdown",
+		HTMLSelector:          cmd.String(ExtractSelectorFlag),
+		HTMLExclude:           cmd.StringSlice(ExtractExcludeFlag),
+		CleanLevel:            cmd.String(ExtractCleanFlag),
+		HTMLFallbackSelectors: cmd.StringSlice(ExtractFallbackFlag),
+		OnNotFound:            cmd.String(ExtractNotFoundFlag),
+		HTMLMatchAll:          cmd.Bool(ExtractMatchAllFlag),
+		MaxInputTokens:        cmd.Int(ExtractMaxTokensFlag),
+		MaxContinuations:      cmd.Int(ExtractMaxContinuationsFlag),
+	}
 	pr, err := c.NewPromptRequest(ctx, &pri)
 	if err != nil {
 		return err
 	}
-	prsp, err := c.ExecPromptFor(ctx, pr, target.String())
+	u, file := cmd.String(ExtractURLFlag), cmd.String(ExtractFileFlag)
+	var prsp *autoklept.PromptResponse
+	switch {
+	case u != "" && file != "":
+		return fmt.Errorf("only one of --%s or --%s may be given", ExtractURLFlag, ExtractFileFlag)
+	case u != "":
+		prsp, err = c.ExecPromptFor(ctx, pr, u)
+	case file != "" && file != "-":
+		bs, rerr := os.ReadFile(file)
+		if rerr != nil {
+			return rerr
+		}
+		prsp, err = c.ExecPromptForHTML(ctx, pr, bs, cmd.String(ExtractBaseURLFlag))
+	default:
+		prsp, err = c.ExecPromptForReader(ctx, pr, os.Stdin, cmd.String(ExtractBaseURLFlag))
+	}
 	if err != nil {
 		return err
 	}
+	// Stats go to stderr so stdout stays pipeable.
+	fmt.Fprintf(os.Stderr, "%d page bytes, %d -> %d HTML bytes cleaned, %d tokens over %d chunk(s), %d continuation(s), %d fetch / %d chat attempt(s)\n",
+		prsp.PageBytes, prsp.HTMLBytesBefore, prsp.HTMLBytesAfter, prsp.TokensUsed, prsp.Chunks, prsp.Continuations, prsp.FetchAttempts, prsp.ChatAttempts)
+	if prsp.Partial {
+		fmt.Fprintf(os.Stderr, "warning: output is partial, still truncated (finish reason %q)\n", prsp.FinishReason)
+	}
 	fmt.Printf("%v\n", prsp.Content)
 	return nil
 }
+
+func newExtractClient(cmd *cli.Command) (*autoklept.Client, error) {
+	key, timeout := cmd.String(ExtractAPIKeyFlag), cmd.Duration(ExtractTimeoutFlag)
+	f, err := newFetcher(cmd)
+	if err != nil {
+		return nil, err
+	}
+	retry := autoklept.DefaultRetryPolicy
+	retry.MaxAttempts = cmd.Int(ExtractMaxAttemptsFlag)
+	opts := []autoklept.ClientOption{
+		autoklept.WithTimeout(timeout),
+		autoklept.WithFetchTimeout(cmd.Duration(ExtractFetchTimeoutFlag)),
+		autoklept.WithURLTimeout(cmd.Duration(ExtractURLTimeoutFlag)),
+		autoklept.WithFetcher(f),
+		autoklept.WithRetry(retry),
+		autoklept.WithRobotsTxt(!cmd.Bool(ExtractIgnoreRobotsFlag)),
+	}
+	switch p := cmd.String(ExtractProviderFlag); p {
+	case ProviderDeepseek:
+		if key == "" {
+			return nil, fmt.Errorf("missing required Deepseek API Key")
+		}
+	case ProviderOllama:
+		op, err := autoklept.NewOllamaProvider(autoklept.OllamaConfig{
+			Host:          cmd.String(ExtractOllamaHostFlag),
+			Model:         cmd.String(ExtractOllamaModelFlag),
+			ContextLength: cmd.Int(ExtractOllamaContextLengthFlag),
+		})
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, autoklept.WithProvider(op))
+	case ProviderOpenAI:
+		op, err := autoklept.NewOpenAIProvider(autoklept.OpenAIConfig{
+			BaseURL: cmd.String(ExtractOpenAIBaseURLFlag),
+			Model:   cmd.String(ExtractOpenAIModelFlag),
+			APIKey:  cmd.String(ExtractOpenAIAPIKeyFlag),
+		})
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, autoklept.WithProvider(op))
+	default:
+		return nil, fmt.Errorf("unknown provider '%s'", p)
+	}
+	return autoklept.NewClient(key, opts...), nil
+}
+
+// fetchFlags are shared by every command that fetches anything.
+func fetchFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  FetchUserAgentFlag,
+			Usage: "User-Agent to fetch with",
+			Value: autoklept.DefaultUserAgent,
+		},
+		&cli.StringSliceFlag{
+			Name:    FetchHeaderFlag,
+			Aliases: []string{"H"},
+			Usage:   "Extra request header as \"Key: Value\"; repeatable",
+		},
+	}
+}
+
+func newFetcher(cmd *cli.Command) (autoklept.Fetcher, error) {
+	header, err := autoklept.ParseHeader(cmd.StringSlice(FetchHeaderFlag))
+	if err != nil {
+		return nil, err
+	}
+	return autoklept.NewHTTPFetcher(autoklept.FetcherConfig{Header: header, UserAgent: cmd.String(FetchUserAgentFlag)}), nil
+}
+
+// newFetchClient is for the commands that never touch an LLM, so it needs no provider config.
+func newFetchClient(cmd *cli.Command, opts ...autoklept.ClientOption) (*autoklept.Client, error) {
+	f, err := newFetcher(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return autoklept.NewClient("", append([]autoklept.ClientOption{autoklept.WithoutProvider(), autoklept.WithFetcher(f)}, opts...)...), nil
+}
@@ -5,13 +5,11 @@ go 1.24.0
 require (
 	github.com/ardanlabs/conf/v3 v3.7.2
 	github.com/cohesion-org/deepseek-go v1.3.1
+	github.com/ollama/ollama v0.6.5
 	github.com/pelletier/go-toml v1.9.5
 	github.com/urfave/cli/v3 v3.3.2
 	golang.org/x/exp v0.0.0-20250218142911-aa4b98e5adaa
 	golang.org/x/net v0.40.0
 )
 
-require (
-	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/ollama/ollama v0.6.5 // indirect
-)
+require github.com/joho/godotenv v1.5.1 // indirect